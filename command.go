@@ -1,75 +1,244 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"strings"
+	"os"
+	"slices"
+	"time"
 )
 
 type Command interface {
-	Execute()
-	Undo()
+	Execute() error
+	Undo() error
 	GetDescription() string
 }
 
+var (
+	ErrNothingToUndo = errors.New("no command to undo")
+	ErrNothingToRedo = errors.New("no command to redo")
+	ErrEditConflict  = errors.New("edit conflict: expected text not found")
+	ErrEditExpired   = errors.New("edit is older than the edit log")
+)
+
+// textEdit は content[pos:pos+len(removed)] を inserted に置き換える1回分の変更
+type textEdit struct {
+	pos      int
+	removed  string
+	inserted string
+}
+
+func (e textEdit) invert() textEdit {
+	return textEdit{pos: e.pos, removed: e.inserted, inserted: e.removed}
+}
+
+// shift は変更前の位置 p を変更後の位置に写す。削除範囲内の位置は変更箇所の先頭に寄せる。
+func (e textEdit) shift(p int) int {
+	switch {
+	case p >= e.pos+len(e.removed):
+		return p + len(e.inserted) - len(e.removed)
+	case p > e.pos:
+		return e.pos
+	default:
+		return p
+	}
+}
+
+// TextEditor の位置・長さを受け取る公開 API はすべて unit 単位で数える。
+// 内部の textEdit とカーソルはバイト位置で保持する。
 type TextEditor struct {
-	content string
-	history []string
+	text *pieceTable
+	// history は AppendText などを直接呼んだ編集1回ごとに、適用した差分だけを保持する。
+	// コマンドは自分で差分を持って取り消すので、ここには積まない。
+	history []*editRecord
+	cursor  int
+	anchor  int
+	unit    TextUnit
+	// listeners は内容が変わるたびに、適用した変更と変更前のバイト長を受け取る
+	listeners []func(edit textEdit, baseLength int)
+	budget    historyBudget
+	// changes は適用した変更のログ。changes[i] は通し番号 changeBase+i の変更で、
+	// editRecord を取り消すときに、その後の変更に合わせて位置をずらすのに使う。
+	changes    []editLogEntry
+	changeBase int
+	// pins は取り消していない editRecord の end ごとの数。最も小さい end より前のログは要らない。
+	pins   map[int]int
+	trimAt int
+	// logLimit は changes に残す変更の上限。0 は無制限。
+	logLimit int
+	// file は読み込み元・保存先のファイルと、保存時に復元する改行コードと BOM
+	file editorFile
+}
+
+type EditorOption func(*TextEditor)
+
+func NewTextEditor(options ...EditorOption) *TextEditor {
+	editor := &TextEditor{
+		text:     newPieceTable(""),
+		history:  make([]*editRecord, 0),
+		unit:     UnitRune,
+		logLimit: defaultEditLogLimit,
+	}
+	for _, option := range options {
+		option(editor)
+	}
+	return editor
 }
 
-func NewTextEditor() *TextEditor {
-	return &TextEditor{
-		content: "",
-		history: make([]string, 0),
+func WithTextUnit(unit TextUnit) EditorOption {
+	return func(te *TextEditor) {
+		te.unit = unit
 	}
 }
 
+func (te *TextEditor) Unit() TextUnit {
+	return te.unit
+}
+
+// Length は内容の長さを unit 単位で返す
+func (te *TextEditor) Length() int {
+	return te.text.Count(te.unit, te.text.Len())
+}
+
 func (te *TextEditor) GetContent() string {
-	return te.content
+	return te.text.String()
 }
 
 func (te *TextEditor) SetContent(content string) {
-	te.history = append(te.history, te.content)
-	te.content = content
+	_ = te.applyEdits([]textEdit{{pos: 0, removed: te.text.String(), inserted: content}})
 }
 
 func (te *TextEditor) RestorePreviousContent() {
 	if len(te.history) > 0 {
-		te.content = te.history[len(te.history)-1]
+		record := te.history[len(te.history)-1]
 		te.history = te.history[:len(te.history)-1]
+		te.budget.bytes -= historyEntrySize(record.edits)
+		if err := te.revertEdits(record); err != nil {
+			te.release(record)
+		}
 	}
 }
 
 func (te *TextEditor) AppendText(text string) {
-	te.history = append(te.history, te.content)
-	te.content += text
+	_ = te.applyEdits(te.appendEdits(text))
 }
 
 func (te *TextEditor) DeleteText(n int) {
-	te.history = append(te.history, te.content)
-	if n >= len(te.content) {
-		te.content = ""
-	} else {
-		te.content = te.content[:len(te.content)-n]
-	}
+	_ = te.applyEdits(te.deleteEdits(n))
 }
 
 func (te *TextEditor) ReplaceText(old, new string) {
-	te.history = append(te.history, te.content)
-	te.content = strings.ReplaceAll(te.content, old, new)
+	_ = te.applyEdits(te.replaceEdits(old, new))
 }
 
 func (te *TextEditor) Clear() {
-	te.history = append(te.history, te.content)
-	te.content = ""
+	_ = te.applyEdits(te.clearEdits())
 }
 
 func (te *TextEditor) Print() {
-	fmt.Printf("内容: \"%s\"\n", te.content)
+	fmt.Printf("内容: \"%s\"\n", te.text.String())
+}
+
+func (te *TextEditor) appendEdits(text string) []textEdit {
+	return []textEdit{{pos: te.text.Len(), inserted: text}}
+}
+
+func (te *TextEditor) deleteEdits(n int) []textEdit {
+	start, ok := te.text.ByteOffset(te.unit, te.Length()-n)
+	if !ok {
+		start = 0
+	}
+	return []textEdit{{pos: start, removed: te.text.Slice(start, te.text.Len())}}
+}
+
+func (te *TextEditor) replaceEdits(old, new string) []textEdit {
+	if old == "" {
+		return nil
+	}
+	edits := make([]textEdit, 0)
+	shift := 0
+	offset := 0
+	for {
+		pos := te.text.Index(old, offset)
+		if pos < 0 {
+			break
+		}
+		// 文字の途中（結合文字の前など）で一致した箇所は置き換えない
+		if !te.text.IsBoundary(te.unit, pos) || !te.text.IsBoundary(te.unit, pos+len(old)) {
+			offset = pos + 1
+			continue
+		}
+		edits = append(edits, textEdit{pos: pos + shift, removed: old, inserted: new})
+		shift += len(new) - len(old)
+		offset = pos + len(old)
+	}
+	return edits
+}
+
+func (te *TextEditor) clearEdits() []textEdit {
+	return []textEdit{{pos: 0, removed: te.text.String()}}
+}
+
+// applyEdits は edits を適用し、RestorePreviousContent 用の履歴に1件として積む。
+// 1つでも適用できない変更があれば、何も変更せずに ErrEditConflict を返す。
+func (te *TextEditor) applyEdits(edits []textEdit) error {
+	record, err := te.record(edits)
+	if err != nil {
+		return err
+	}
+	te.pushHistory(record)
+	return nil
+}
+
+// apply は edits を順に適用し、適用した変更を返す
+func (te *TextEditor) apply(edits []textEdit) ([]textEdit, error) {
+	return te.applyChanges(edits, -1)
+}
+
+// applyChanges は apply の本体。undoes は editRecord を取り消すための変更なら、その記録の start。
+func (te *TextEditor) applyChanges(edits []textEdit, undoes int) ([]textEdit, error) {
+	start := te.changeCount()
+	applied := make([]textEdit, 0, len(edits))
+	for _, edit := range edits {
+		if !te.matches(edit) {
+			_, _ = te.apply(invertEdits(applied))
+			// 元に戻した分は、変更ログからも取り除く。巻き戻しの途中でログを捨てていれば、残りを取り除く。
+			te.changes = te.changes[:max(0, start-te.changeBase)]
+			return nil, fmt.Errorf("%w: %q", ErrEditConflict, edit.removed)
+		}
+		baseLength := te.text.Len()
+		te.text.Replace(edit.pos, len(edit.removed), edit.inserted)
+		te.cursor = edit.shift(te.cursor)
+		te.anchor = edit.shift(te.anchor)
+		te.logChange(edit, start, undoes)
+		applied = append(applied, edit)
+		for _, listener := range te.listeners {
+			listener(edit, baseLength)
+		}
+	}
+	te.limitLog()
+	return applied, nil
+}
+
+func invertEdits(edits []textEdit) []textEdit {
+	inverse := make([]textEdit, len(edits))
+	for i, edit := range edits {
+		inverse[len(edits)-1-i] = edit.invert()
+	}
+	return inverse
+}
+
+// matches は edit.pos に edit.removed がそのまま存在するかどうかを返す
+func (te *TextEditor) matches(edit textEdit) bool {
+	end := edit.pos + len(edit.removed)
+	return edit.pos >= 0 && end <= te.text.Len() &&
+		(edit.removed == "" || te.text.Slice(edit.pos, end) == edit.removed)
 }
 
 type WriteCommand struct {
 	editor *TextEditor
 	text   string
+	record *editRecord
 }
 
 func NewWriteCommand(editor *TextEditor, text string) *WriteCommand {
@@ -79,12 +248,17 @@ func NewWriteCommand(editor *TextEditor, text string) *WriteCommand {
 	}
 }
 
-func (wc *WriteCommand) Execute() {
-	wc.editor.AppendText(wc.text)
+func (wc *WriteCommand) Execute() error {
+	record, err := wc.editor.record(wc.editor.appendEdits(wc.text))
+	if err != nil {
+		return err
+	}
+	wc.record = record
+	return nil
 }
 
-func (wc *WriteCommand) Undo() {
-	wc.editor.RestorePreviousContent()
+func (wc *WriteCommand) Undo() error {
+	return wc.editor.revertEdits(wc.record)
 }
 
 func (wc *WriteCommand) GetDescription() string {
@@ -94,6 +268,7 @@ func (wc *WriteCommand) GetDescription() string {
 type DeleteCommand struct {
 	editor *TextEditor
 	length int
+	record *editRecord
 }
 
 func NewDeleteCommand(editor *TextEditor, length int) *DeleteCommand {
@@ -103,12 +278,20 @@ func NewDeleteCommand(editor *TextEditor, length int) *DeleteCommand {
 	}
 }
 
-func (dc *DeleteCommand) Execute() {
-	dc.editor.DeleteText(dc.length)
+func (dc *DeleteCommand) Execute() error {
+	if dc.length < 0 {
+		return fmt.Errorf("delete: invalid length %d", dc.length)
+	}
+	record, err := dc.editor.record(dc.editor.deleteEdits(dc.length))
+	if err != nil {
+		return err
+	}
+	dc.record = record
+	return nil
 }
 
-func (dc *DeleteCommand) Undo() {
-	dc.editor.RestorePreviousContent()
+func (dc *DeleteCommand) Undo() error {
+	return dc.editor.revertEdits(dc.record)
 }
 
 func (dc *DeleteCommand) GetDescription() string {
@@ -119,6 +302,7 @@ type ReplaceCommand struct {
 	editor *TextEditor
 	old    string
 	new    string
+	record *editRecord
 }
 
 func NewReplaceCommand(editor *TextEditor, old, new string) *ReplaceCommand {
@@ -129,12 +313,20 @@ func NewReplaceCommand(editor *TextEditor, old, new string) *ReplaceCommand {
 	}
 }
 
-func (rc *ReplaceCommand) Execute() {
-	rc.editor.ReplaceText(rc.old, rc.new)
+func (rc *ReplaceCommand) Execute() error {
+	if rc.old == "" {
+		return errors.New("replace: search text is empty")
+	}
+	record, err := rc.editor.record(rc.editor.replaceEdits(rc.old, rc.new))
+	if err != nil {
+		return err
+	}
+	rc.record = record
+	return nil
 }
 
-func (rc *ReplaceCommand) Undo() {
-	rc.editor.RestorePreviousContent()
+func (rc *ReplaceCommand) Undo() error {
+	return rc.editor.revertEdits(rc.record)
 }
 
 func (rc *ReplaceCommand) GetDescription() string {
@@ -143,6 +335,7 @@ func (rc *ReplaceCommand) GetDescription() string {
 
 type ClearCommand struct {
 	editor *TextEditor
+	record *editRecord
 }
 
 func NewClearCommand(editor *TextEditor) *ClearCommand {
@@ -151,12 +344,17 @@ func NewClearCommand(editor *TextEditor) *ClearCommand {
 	}
 }
 
-func (cc *ClearCommand) Execute() {
-	cc.editor.Clear()
+func (cc *ClearCommand) Execute() error {
+	record, err := cc.editor.record(cc.editor.clearEdits())
+	if err != nil {
+		return err
+	}
+	cc.record = record
+	return nil
 }
 
-func (cc *ClearCommand) Undo() {
-	cc.editor.RestorePreviousContent()
+func (cc *ClearCommand) Undo() error {
+	return cc.editor.revertEdits(cc.record)
 }
 
 func (cc *ClearCommand) GetDescription() string {
@@ -179,58 +377,219 @@ func (mc *MacroCommand) AddCommand(command Command) {
 	mc.commands = append(mc.commands, command)
 }
 
-func (mc *MacroCommand) Execute() {
-	for _, command := range mc.commands {
-		command.Execute()
+// Execute は子コマンドを順に実行し、途中で失敗した場合は
+// 実行済みの子コマンドを逆順に取り消してから MacroCommandError を返す。
+func (mc *MacroCommand) Execute() error {
+	for i, command := range mc.commands {
+		if err := command.Execute(); err != nil {
+			return &MacroCommandError{
+				Index:       i,
+				Command:     command,
+				Err:         err,
+				RollbackErr: mc.undoRange(i - 1),
+			}
+		}
 	}
+	return nil
 }
 
-func (mc *MacroCommand) Undo() {
+// Undo は子コマンドを逆順に取り消し、途中で失敗した場合は
+// 取り消し済みの子コマンドを再実行して元の状態に戻す。
+func (mc *MacroCommand) Undo() error {
 	for i := len(mc.commands) - 1; i >= 0; i-- {
-		mc.commands[i].Undo()
+		if err := mc.commands[i].Undo(); err != nil {
+			return &MacroCommandError{
+				Index:       i,
+				Command:     mc.commands[i],
+				Err:         err,
+				RollbackErr: mc.executeRange(i + 1),
+			}
+		}
+	}
+	return nil
+}
+
+func (mc *MacroCommand) undoRange(last int) error {
+	var errs []error
+	for i := last; i >= 0; i-- {
+		if err := mc.commands[i].Undo(); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(errs...)
+}
+
+func (mc *MacroCommand) executeRange(first int) error {
+	var errs []error
+	for i := first; i < len(mc.commands); i++ {
+		if err := mc.commands[i].Execute(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (mc *MacroCommand) GetDescription() string {
 	return fmt.Sprintf("Macro: %s (%d commands)", mc.description, len(mc.commands))
 }
 
+// MacroCommandError は MacroCommand の何番目の子コマンドが失敗したかを表す
+type MacroCommandError struct {
+	Index       int
+	Command     Command
+	Err         error
+	RollbackErr error
+}
+
+func (e *MacroCommandError) Error() string {
+	msg := fmt.Sprintf("macro step %d (%s) failed: %v", e.Index+1, e.Command.GetDescription(), e.Err)
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf(" (rollback failed: %v)", e.RollbackErr)
+	}
+	return msg
+}
+
+func (e *MacroCommandError) Unwrap() error {
+	return e.Err
+}
+
+// CommandInvoker は実行したコマンドを取り消しツリーとして保持する。
+// 取り消した後に別のコマンドを実行しても、取り消した枝は失われない。
 type CommandInvoker struct {
-	history []Command
+	root    *undoNode
+	current *undoNode
+	// saved は最後に保存した時点の状態を表すノード。現在位置と異なれば未保存の変更がある。
+	saved *undoNode
+	// nodes は削除されていないノードを ID で引く。古いノードを捨てても ID は振り直さない。
+	nodes   map[int]*undoNode
+	nextID  int
+	budget  historyBudget
+	journal *CommandJournal
+	// coalesceWindow が正のとき、この時間内に続いた結合可能なコマンドを1つの履歴にまとめる
+	coalesceWindow time.Duration
+	now            func() time.Time
+	middlewares    []CommandMiddleware
+	handler        CommandHandler
+	// recording は StartRecording から StopRecording までに実行したコマンドを集める
+	recording *commandRecording
+}
+
+type InvokerOption func(*CommandInvoker)
+
+func NewCommandInvoker(options ...InvokerOption) *CommandInvoker {
+	root := &undoNode{}
+	invoker := &CommandInvoker{
+		root:    root,
+		current: root,
+		saved:   root,
+		nodes:   map[int]*undoNode{root.id: root},
+		nextID:  root.id + 1,
+		now:     time.Now,
+	}
+	for _, option := range options {
+		option(invoker)
+	}
+	invoker.handler = chainMiddlewares(runCommand, invoker.middlewares)
+	return invoker
+}
+
+// WithJournal は実行・取り消し・やり直しを journal に追記するようにする
+func WithJournal(journal *CommandJournal) InvokerOption {
+	return func(ci *CommandInvoker) {
+		ci.journal = journal
+	}
+}
+
+// WithCoalescing は window 以内に続いた結合可能なコマンド（連続した入力や削除）を1つの履歴にまとめる
+func WithCoalescing(window time.Duration) InvokerOption {
+	return func(ci *CommandInvoker) {
+		ci.coalesceWindow = window
+	}
+}
+
+// WithClock は履歴の時刻に使う時計を差し替える
+func WithClock(now func() time.Time) InvokerOption {
+	return func(ci *CommandInvoker) {
+		ci.now = now
+	}
+}
+
+// ExecuteCommand は command を実行し、成功した場合だけ現在位置の子として履歴に積む
+func (ci *CommandInvoker) ExecuteCommand(command Command) error {
+	return ci.execute(command, false)
 }
 
-func NewCommandInvoker() *CommandInvoker {
-	return &CommandInvoker{
-		history: make([]Command, 0),
+// execute は command を実行する。forceMerge のときは時間に関係なく直前の履歴への結合を試みる。
+func (ci *CommandInvoker) execute(command Command, forceMerge bool) error {
+	if err := ci.handler(OperationExecute, command); err != nil {
+		return err
+	}
+	if transient, ok := command.(TransientCommand); ok && transient.Transient() {
+		ci.markSavePoint(command)
+		return nil
+	}
+	merge := ci.canCoalesce(command, forceMerge)
+	op := JournalExecute
+	if merge {
+		op = JournalMerge
+	}
+	if err := ci.journal.Append(op, command); err != nil {
+		// 記録できなかった変更は残さない
+		return errors.Join(err, command.Undo())
+	}
+	if merge {
+		ci.current.command.(MergeableCommand).Merge(command)
+		ci.current.executedAt = ci.now()
+		ci.resize(ci.current)
+		ci.recording.capture(command, ci.current)
+		return nil
 	}
+	ci.addNode(command)
+	ci.markSavePoint(command)
+	ci.recording.capture(command, ci.current)
+	return nil
 }
 
-func (ci *CommandInvoker) ExecuteCommand(command Command) {
-	fmt.Printf("実行: %s\n", command.GetDescription())
-	command.Execute()
-	ci.history = append(ci.history, command)
+func (ci *CommandInvoker) UndoLastCommand() error {
+	if !ci.CanUndo() {
+		return ErrNothingToUndo
+	}
+	if err := ci.undoStep(); err != nil {
+		return err
+	}
+	if err := ci.journal.Append(JournalUndo, nil); err != nil {
+		return errors.Join(err, ci.redoStep(ci.current.redo))
+	}
+	return nil
 }
 
-func (ci *CommandInvoker) UndoLastCommand() {
-	if len(ci.history) > 0 {
-		lastCommand := ci.history[len(ci.history)-1]
-		fmt.Printf("取り消し: %s\n", lastCommand.GetDescription())
-		lastCommand.Undo()
-		ci.history = ci.history[:len(ci.history)-1]
-	} else {
-		fmt.Println("取り消すコマンドがありません。")
+// RedoLastCommand は現在位置から、最後に通った枝（SelectRedoBranch で選んだ枝）をやり直す
+func (ci *CommandInvoker) RedoLastCommand() error {
+	if !ci.CanRedo() {
+		return ErrNothingToRedo
+	}
+	if err := ci.redoStep(ci.current.redo); err != nil {
+		return err
 	}
+	if err := ci.journal.Append(JournalRedo, nil); err != nil {
+		return errors.Join(err, ci.undoStep())
+	}
+	return nil
+}
+
+func (ci *CommandInvoker) CanUndo() bool {
+	return ci.current != ci.root
 }
 
+func (ci *CommandInvoker) CanRedo() bool {
+	return ci.current.redo != nil
+}
+
+// ShowHistory は初期状態から現在位置までに適用されているコマンドを表示する
 func (ci *CommandInvoker) ShowHistory() {
 	fmt.Println("\n--- コマンド履歴 ---")
-	if len(ci.history) == 0 {
-		fmt.Println("（履歴なし）")
-	} else {
-		for i, command := range ci.history {
-			fmt.Printf("%d. %s\n", i+1, command.GetDescription())
-		}
-	}
+	applied := slices.DeleteFunc(ci.History(), func(entry HistoryEntry) bool { return entry.Undone })
+	_ = RenderHistory(os.Stdout, applied, HistoryText)
 	fmt.Println("---")
 }
 
@@ -238,7 +597,7 @@ func ExecCommand() {
 	fmt.Println("=== Command Pattern Demo ===")
 
 	editor := NewTextEditor()
-	invoker := NewCommandInvoker()
+	invoker := NewCommandInvoker(WithMiddleware(LoggingMiddleware(os.Stdout)))
 
 	fmt.Println("初期状態:")
 	editor.Print()
@@ -272,6 +631,12 @@ func ExecCommand() {
 	invoker.UndoLastCommand()
 	editor.Print()
 
+	fmt.Println("\n--- Redo テスト ---")
+	fmt.Printf("CanUndo: %v, CanRedo: %v\n", invoker.CanUndo(), invoker.CanRedo())
+	fmt.Println("取り消したコマンドをやり直し:")
+	invoker.RedoLastCommand()
+	editor.Print()
+
 	fmt.Println("\n--- Macro コマンドテスト ---")
 
 	macro := NewMacroCommand("挨拶文作成")
@@ -287,6 +652,49 @@ func ExecCommand() {
 	invoker.UndoLastCommand()
 	editor.Print()
 
+	fmt.Println("\n--- 直接編集との混在テスト ---")
+	invoker.ExecuteCommand(NewWriteCommand(editor, " Let's code."))
+	editor.AppendText(" (直接追記)")
+	editor.Print()
+	fmt.Println("コマンドだけを取り消し:")
+	invoker.UndoLastCommand()
+	editor.Print()
+
+	fmt.Println("\n--- カーソルと選択範囲 ---")
+	invoker.ExecuteCommand(NewInsertCommand(editor, 0, ">> "))
+	editor.Print()
+	invoker.ExecuteCommand(NewSelectCommand(editor, 9, 11))
+	fmt.Printf("選択中: \"%s\"\n", editor.SelectedText())
+	invoker.ExecuteCommand(NewReplaceSelectionCommand(editor, "Golang"))
+	editor.Print()
+	invoker.ExecuteCommand(NewDeleteRangeCommand(editor, 0, 3))
+	editor.Print()
+	invoker.UndoLastCommand()
+	invoker.UndoLastCommand()
+	editor.Print()
+	fmt.Printf("選択中: \"%s\"\n", editor.SelectedText())
+
+	fmt.Println("\n--- Unicode テスト ---")
+	for _, unit := range []TextUnit{UnitRune, UnitGrapheme} {
+		unicodeEditor := NewTextEditor(WithTextUnit(unit))
+		unicodeInvoker := NewCommandInvoker(WithMiddleware(LoggingMiddleware(os.Stdout)))
+		unicodeInvoker.ExecuteCommand(NewWriteCommand(unicodeEditor, "こんにちは👨‍👩‍👧🇯🇵"))
+		fmt.Printf("単位: %s, 長さ: %d\n", unit, unicodeEditor.Length())
+		unicodeInvoker.ExecuteCommand(NewDeleteCommand(unicodeEditor, 2))
+		unicodeEditor.Print()
+		unicodeInvoker.ExecuteCommand(NewInsertCommand(unicodeEditor, 2, "😀"))
+		unicodeEditor.Print()
+	}
+
+	fmt.Println("\n--- 失敗するマクロのロールバックテスト ---")
+	broken := NewMacroCommand("途中で失敗する編集")
+	broken.AddCommand(NewWriteCommand(editor, " 追記"))
+	broken.AddCommand(NewReplaceCommand(editor, "", "x"))
+	if err := invoker.ExecuteCommand(broken); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+	editor.Print()
+
 	invoker.ShowHistory()
 
 	fmt.Println("\n=== Demo completed ===")
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrInvokerClosed = errors.New("async invoker is closed")
+
+// CommandFuture は非同期に投入した操作の結果
+type CommandFuture struct {
+	done chan struct{}
+	err  error
+}
+
+func newCommandFuture() *CommandFuture {
+	return &CommandFuture{done: make(chan struct{})}
+}
+
+func (f *CommandFuture) complete(err error) {
+	f.err = err
+	close(f.done)
+}
+
+func (f *CommandFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err は完了した操作の結果を返す。Done が閉じる前に呼んではいけない。
+func (f *CommandFuture) Err() error {
+	return f.err
+}
+
+// Wait は操作の完了か ctx の終了まで待つ。ctx が先に終わっても操作自体は取り消されない。
+func (f *CommandFuture) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type asyncRequest struct {
+	ctx    context.Context
+	run    func(invoker *CommandInvoker) error
+	future *CommandFuture
+}
+
+// AsyncCommandInvoker は複数の goroutine から投入された操作を、1つのワーカーで順番に CommandInvoker に適用する
+type AsyncCommandInvoker struct {
+	invoker  *CommandInvoker
+	requests chan asyncRequest
+	closing  chan struct{}
+	stopped  chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	senders sync.WaitGroup
+}
+
+func NewAsyncCommandInvoker(invoker *CommandInvoker, queueSize int) *AsyncCommandInvoker {
+	a := &AsyncCommandInvoker{
+		invoker:  invoker,
+		requests: make(chan asyncRequest, queueSize),
+		closing:  make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go a.work()
+	return a
+}
+
+func (a *AsyncCommandInvoker) work() {
+	defer close(a.stopped)
+	for req := range a.requests {
+		// 待っている間にキャンセル・期限切れになった操作は実行しない
+		if err := req.ctx.Err(); err != nil {
+			req.future.complete(err)
+			continue
+		}
+		req.future.complete(req.run(a.invoker))
+	}
+}
+
+func (a *AsyncCommandInvoker) Submit(ctx context.Context, command Command) *CommandFuture {
+	return a.Do(ctx, func(invoker *CommandInvoker) error {
+		return invoker.ExecuteCommand(command)
+	})
+}
+
+func (a *AsyncCommandInvoker) SubmitUndo(ctx context.Context) *CommandFuture {
+	return a.Do(ctx, func(invoker *CommandInvoker) error {
+		return invoker.UndoLastCommand()
+	})
+}
+
+func (a *AsyncCommandInvoker) SubmitRedo(ctx context.Context) *CommandFuture {
+	return a.Do(ctx, func(invoker *CommandInvoker) error {
+		return invoker.RedoLastCommand()
+	})
+}
+
+// Do は fn をワーカー上で実行する。エディタの内容を読むなど、任意の処理を他の操作と直列化したいときに使う。
+func (a *AsyncCommandInvoker) Do(ctx context.Context, fn func(invoker *CommandInvoker) error) *CommandFuture {
+	future := newCommandFuture()
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		future.complete(ErrInvokerClosed)
+		return future
+	}
+	a.senders.Add(1)
+	a.mu.Unlock()
+	defer a.senders.Done()
+
+	select {
+	case a.requests <- asyncRequest{ctx: ctx, run: fn, future: future}:
+	case <-ctx.Done():
+		future.complete(ctx.Err())
+	case <-a.closing:
+		future.complete(ErrInvokerClosed)
+	}
+	return future
+}
+
+// Close は新しい投入を受け付けなくし、キューに入っている操作をすべて処理し終えるまで待つ。
+// ctx が先に終わった場合も、残りの操作はバックグラウンドで処理される。
+func (a *AsyncCommandInvoker) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.closing)
+		go func() {
+			a.senders.Wait()
+			close(a.requests)
+		}()
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func ExecAsyncCommandInvoker() {
+	fmt.Println("=== Async Command Invoker Demo ===")
+
+	editor := NewTextEditor()
+	async := NewAsyncCommandInvoker(NewCommandInvoker(), 16)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			future := async.Submit(ctx, NewWriteCommand(editor, fmt.Sprintf("[%d]", i)))
+			if err := future.Wait(ctx); err != nil {
+				fmt.Printf("クライアント%d: エラー: %v\n", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	async.Do(context.Background(), func(*CommandInvoker) error {
+		// ワーカー上で読むので、他の操作と競合しない
+		editor.Print()
+		return nil
+	}).Wait(context.Background())
+
+	fmt.Println("\n--- キャンセル済みのコンテキスト ---")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := async.Submit(ctx, NewClearCommand(editor)).Wait(context.Background()); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+
+	fmt.Println("\n--- 取り消しを投入してから終了 ---")
+	undo := async.SubmitUndo(context.Background())
+	if err := async.Close(context.Background()); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+	fmt.Printf("取り消しの結果: %v\n", undo.Err())
+	fmt.Printf("終了後の投入: %v\n", async.Submit(context.Background(), NewClearCommand(editor)).Err())
+
+	// ワーカーが止まった後なので、ここからは直接読んでよい
+	fmt.Printf("文字数: %d\n", editor.Length())
+
+	fmt.Println("\n=== Demo completed ===")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockWorker はワーカーを release が閉じるまで止める
+func blockWorker(t *testing.T, async *AsyncCommandInvoker) (release func()) {
+	t.Helper()
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	async.Do(context.Background(), func(*CommandInvoker) error {
+		close(started)
+		<-unblock
+		return nil
+	})
+	<-started
+	return func() { close(unblock) }
+}
+
+// 1つの goroutine から投入した操作は、完了を待たなくても投入した順に適用される
+func TestAsyncAppliesInSubmissionOrder(t *testing.T) {
+	editor := NewTextEditor()
+	async := NewAsyncCommandInvoker(NewCommandInvoker(), 4)
+	ctx := context.Background()
+	futures := []*CommandFuture{
+		async.Submit(ctx, NewWriteCommand(editor, "a")),
+		async.Submit(ctx, NewWriteCommand(editor, "b")),
+		async.SubmitUndo(ctx),
+		async.SubmitRedo(ctx),
+		async.SubmitUndo(ctx),
+		async.Submit(ctx, NewWriteCommand(editor, "c")),
+	}
+	for i, future := range futures {
+		if err := future.Wait(ctx); err != nil {
+			t.Fatalf("operation %d: %v", i, err)
+		}
+	}
+	if err := async.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := editor.GetContent(); got != "ac" {
+		t.Errorf("content = %q, want %q", got, "ac")
+	}
+}
+
+func TestAsyncConcurrentSubmitters(t *testing.T) {
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker()
+	async := NewAsyncCommandInvoker(invoker, 8)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*30)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for k := 0; k < 10; k++ {
+				errs <- async.Submit(ctx, NewWriteCommand(editor, fmt.Sprintf("[%d:%d]", g, k))).Wait(ctx)
+				// 他の goroutine の操作と入れ替わりうるので、何もない取り消し・やり直しは失敗してよい
+				for _, err := range []error{async.SubmitUndo(ctx).Wait(ctx), async.SubmitRedo(ctx).Wait(ctx)} {
+					if !errors.Is(err, ErrNothingToUndo) && !errors.Is(err, ErrNothingToRedo) {
+						errs <- err
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err := async.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("operation failed: %v", err)
+		}
+	}
+
+	// 各 goroutine の書き込みは、その goroutine が投入した順に並んでいる
+	content := editor.GetContent()
+	for g := 0; g < 8; g++ {
+		last := -1
+		for k := 0; k < 10; k++ {
+			if i := strings.Index(content, fmt.Sprintf("[%d:%d]", g, k)); i >= 0 {
+				if i < last {
+					t.Errorf("[%d:%d] is before an earlier write in %q", g, k, content)
+				}
+				last = i
+			}
+		}
+	}
+	// 履歴と内容が食い違っていなければ、初期状態まで戻せる
+	if err := invoker.JumpTo(0); err != nil || editor.GetContent() != "" {
+		t.Errorf("JumpTo(0): %q, %v", editor.GetContent(), err)
+	}
+}
+
+func TestAsyncContextCancellation(t *testing.T) {
+	editor := NewTextEditor()
+	async := NewAsyncCommandInvoker(NewCommandInvoker(), 1)
+	defer async.Close(context.Background())
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := async.Submit(cancelled, NewWriteCommand(editor, "x")).Wait(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled before submit: error = %v, want context.Canceled", err)
+	}
+
+	release := blockWorker(t, async)
+	// キューで待っている間にキャンセルされた操作は実行しない
+	queuedCtx, cancelQueued := context.WithCancel(context.Background())
+	queued := async.Submit(queuedCtx, NewWriteCommand(editor, "queued"))
+	// キューが一杯で投入を待っている間にキャンセルされた操作も同じ
+	blockedCtx, cancelBlocked := context.WithCancel(context.Background())
+	blocked := make(chan *CommandFuture)
+	go func() { blocked <- async.Submit(blockedCtx, NewWriteCommand(editor, "blocked")) }()
+	cancelQueued()
+	cancelBlocked()
+	blockedFuture := <-blocked
+
+	// 待つ側の ctx が先に終わっても、操作そのものは取り消されない
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancelWait()
+	if err := queued.Wait(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait with an expired context: error = %v, want DeadlineExceeded", err)
+	}
+	release()
+
+	ctx := context.Background()
+	if err := queued.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled while queued: error = %v, want context.Canceled", err)
+	}
+	if err := blockedFuture.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled while blocked: error = %v, want context.Canceled", err)
+	}
+	if err := async.Submit(ctx, NewWriteCommand(editor, "ok")).Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := editor.GetContent(); got != "ok" {
+		t.Errorf("content = %q, want only the uncancelled write", got)
+	}
+}
+
+func TestAsyncCloseDrainsAndRejects(t *testing.T) {
+	editor := NewTextEditor()
+	async := NewAsyncCommandInvoker(NewCommandInvoker(), 8)
+	ctx := context.Background()
+
+	release := blockWorker(t, async)
+	var pending []*CommandFuture
+	for i := 0; i < 5; i++ {
+		pending = append(pending, async.Submit(ctx, NewWriteCommand(editor, fmt.Sprint(i))))
+	}
+
+	// 期限内に処理し終わらなくても、Close は新しい投入を止める
+	expired, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := async.Close(expired); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close with a blocked worker: error = %v, want DeadlineExceeded", err)
+	}
+	if err := async.Submit(ctx, NewWriteCommand(editor, "late")).Err(); !errors.Is(err, ErrInvokerClosed) {
+		t.Errorf("submit after Close: error = %v, want ErrInvokerClosed", err)
+	}
+
+	release()
+	if err := async.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	for i, future := range pending {
+		select {
+		case <-future.Done():
+		default:
+			t.Fatalf("operation %d is not done after Close", i)
+		}
+		if err := future.Err(); err != nil {
+			t.Errorf("operation %d: %v", i, err)
+		}
+	}
+	if got := editor.GetContent(); got != "01234" {
+		t.Errorf("content = %q, want every queued write", got)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// MergeableCommand は直後に実行された同種のコマンドを取り込み、1つの履歴としてまとめられるコマンド
+type MergeableCommand interface {
+	Command
+	// CanMerge は実行済みの next を取り込めるかどうかを返す
+	CanMerge(next Command) bool
+	// Merge は next を取り込む。取り込んだ後の Undo は両方の変更をまとめて打ち消す。
+	Merge(next Command)
+}
+
+func (ci *CommandInvoker) canCoalesce(command Command, force bool) bool {
+	if !force && ci.coalesceWindow <= 0 {
+		return false
+	}
+	node := ci.current
+	// 取り消した枝が残っているノードに結合すると、その枝の前提が変わってしまう。
+	// 保存した時点のノードに結合すると、内容が変わっても未保存と判定できなくなる。
+	if node == ci.root || node == ci.saved || len(node.children) > 0 {
+		return false
+	}
+	if !force && ci.now().Sub(node.executedAt) > ci.coalesceWindow {
+		return false
+	}
+	mergeable, ok := node.command.(MergeableCommand)
+	return ok && mergeable.CanMerge(command)
+}
+
+// adjacent は b が a の直後に、間に他の変更を挟まずに適用されたかどうかを返す
+func adjacent(a, b *editRecord) bool {
+	return a != nil && b != nil && a.end == b.start
+}
+
+// followsInsert は b が a の挿入の直後に続けて挿入したものかどうかを返す
+func followsInsert(a, b *editRecord) bool {
+	return adjacent(a, b) && len(a.edits) == 1 && len(b.edits) == 1 &&
+		a.edits[0].removed == "" && b.edits[0].removed == "" &&
+		b.edits[0].pos == a.edits[0].pos+len(a.edits[0].inserted)
+}
+
+func mergeInserts(editor *TextEditor, a, b *editRecord) *editRecord {
+	merged := textEdit{pos: a.edits[0].pos, inserted: a.edits[0].inserted + b.edits[0].inserted}
+	return editor.mergeRecords(a, b, []textEdit{merged})
+}
+
+// isBackspace は b が a で削除した範囲の直前を削除したものかどうかを返す
+func isBackspace(a, b *editRecord) bool {
+	return isSingleDelete(a, b) && b.edits[0].pos+len(b.edits[0].removed) == a.edits[0].pos
+}
+
+// isForwardDelete は b が a で削除した位置から続けて後ろを削除したものかどうかを返す
+func isForwardDelete(a, b *editRecord) bool {
+	return isSingleDelete(a, b) && b.edits[0].pos == a.edits[0].pos
+}
+
+// isSingleDelete は a と b がどちらも1箇所の削除で、続けて適用されたかどうかを返す
+func isSingleDelete(a, b *editRecord) bool {
+	return adjacent(a, b) && len(a.edits) == 1 && len(b.edits) == 1 &&
+		a.edits[0].inserted == "" && b.edits[0].inserted == ""
+}
+
+func mergeDeletes(editor *TextEditor, a, b *editRecord) *editRecord {
+	merged := textEdit{pos: a.edits[0].pos, removed: a.edits[0].removed + b.edits[0].removed}
+	if isBackspace(a, b) {
+		merged = textEdit{pos: b.edits[0].pos, removed: b.edits[0].removed + a.edits[0].removed}
+	}
+	return editor.mergeRecords(a, b, []textEdit{merged})
+}
+
+func (wc *WriteCommand) CanMerge(next Command) bool {
+	other, ok := next.(*WriteCommand)
+	return ok && other.editor == wc.editor && followsInsert(wc.record, other.record)
+}
+
+func (wc *WriteCommand) Merge(next Command) {
+	other := next.(*WriteCommand)
+	wc.text += other.text
+	wc.record = mergeInserts(wc.editor, wc.record, other.record)
+}
+
+func (ic *InsertCommand) CanMerge(next Command) bool {
+	other, ok := next.(*InsertCommand)
+	return ok && other.editor == ic.editor && followsInsert(ic.record, other.record)
+}
+
+func (ic *InsertCommand) Merge(next Command) {
+	other := next.(*InsertCommand)
+	ic.text += other.text
+	ic.record = mergeInserts(ic.editor, ic.record, other.record)
+}
+
+func (dc *DeleteCommand) CanMerge(next Command) bool {
+	other, ok := next.(*DeleteCommand)
+	return ok && other.editor == dc.editor && isBackspace(dc.record, other.record)
+}
+
+func (dc *DeleteCommand) Merge(next Command) {
+	other := next.(*DeleteCommand)
+	dc.length += other.length
+	dc.record = mergeDeletes(dc.editor, dc.record, other.record)
+}
+
+func (dc *DeleteRangeCommand) CanMerge(next Command) bool {
+	other, ok := next.(*DeleteRangeCommand)
+	return ok && other.editor == dc.editor &&
+		(isBackspace(dc.record, other.record) || isForwardDelete(dc.record, other.record))
+}
+
+func (dc *DeleteRangeCommand) Merge(next Command) {
+	other := next.(*DeleteRangeCommand)
+	length := (dc.end - dc.start) + (other.end - other.start)
+	if isBackspace(dc.record, other.record) {
+		dc.start = other.start
+	}
+	dc.end = dc.start + length
+	dc.record = mergeDeletes(dc.editor, dc.record, other.record)
+}
+
+func ExecCommandCoalescing() {
+	fmt.Println("=== Command Coalescing Demo ===")
+
+	// 時刻を自由に進められる時計で、入力の間隔を再現する
+	clock := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	tick := func(d time.Duration) { clock = clock.Add(d) }
+
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(
+		WithMiddleware(LoggingMiddleware(os.Stdout)),
+		WithCoalescing(time.Second),
+		WithClock(func() time.Time { return clock }),
+	)
+
+	for _, ch := range "Hello" {
+		invoker.ExecuteCommand(NewWriteCommand(editor, string(ch)))
+		tick(200 * time.Millisecond)
+	}
+	tick(3 * time.Second)
+	for _, ch := range ", Go" {
+		invoker.ExecuteCommand(NewWriteCommand(editor, string(ch)))
+		tick(200 * time.Millisecond)
+	}
+	for i := 0; i < 2; i++ {
+		invoker.ExecuteCommand(NewDeleteCommand(editor, 1))
+		tick(200 * time.Millisecond)
+	}
+	editor.Print()
+	invoker.ShowHistory()
+
+	fmt.Println("\n--- 1回ずつ取り消し ---")
+	for invoker.CanUndo() {
+		invoker.UndoLastCommand()
+		editor.Print()
+	}
+
+	fmt.Println("\n=== Demo completed ===")
+}
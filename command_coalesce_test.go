@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCoalescingBoundaries(t *testing.T) {
+	type step struct {
+		build func(editor *TextEditor) Command
+		// wait は実行する前に進める時間
+		wait time.Duration
+	}
+	write := func(text string) step {
+		return step{build: func(e *TextEditor) Command { return NewWriteCommand(e, text) }}
+	}
+	insert := func(pos int, text string) step {
+		return step{build: func(e *TextEditor) Command { return NewInsertCommand(e, pos, text) }}
+	}
+	deleteRange := func(start, end int) step {
+		return step{build: func(e *TextEditor) Command { return NewDeleteRangeCommand(e, start, end) }}
+	}
+	backspace := step{build: func(e *TextEditor) Command { return NewDeleteCommand(e, 1) }}
+	later := func(s step) step {
+		s.wait = 2 * time.Second
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		initial string
+		steps   []step
+		content string
+		// undone は1回取り消した後の内容
+		undone string
+	}{
+		{"typing", "", []step{write("a"), write("b"), write("c")}, "abc", ""},
+		{"pause between keys", "", []step{write("a"), write("b"), later(write("c"))}, "abc", "ab"},
+		{"insert at the caret", "xy", []step{insert(1, "a"), insert(2, "b")}, "xaby", "xy"},
+		{"cursor jump", "xy", []step{insert(1, "a"), insert(3, "b")}, "xayb", "xay"},
+		{"different command type", "xy", []step{write("a"), insert(3, "b")}, "xyab", "xya"},
+		{"backspaces", "hello", []step{backspace, backspace, backspace}, "he", "hello"},
+		{"backspace after typing", "", []step{write("ab"), backspace}, "a", "ab"},
+		{"forward deletes", "hello", []step{deleteRange(1, 2), deleteRange(1, 2)}, "hlo", "hello"},
+		{"backspace range", "hello", []step{deleteRange(3, 4), deleteRange(2, 3)}, "heo", "hello"},
+		{"deletes apart", "hello", []step{deleteRange(0, 1), deleteRange(2, 3)}, "elo", "ello"},
+	}
+	for _, tt := range tests {
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		editor := NewTextEditor()
+		editor.SetContent(tt.initial)
+		invoker := NewCommandInvoker(WithCoalescing(time.Second), WithClock(func() time.Time { return now }))
+		for _, s := range tt.steps {
+			now = now.Add(s.wait + 100*time.Millisecond)
+			if err := invoker.ExecuteCommand(s.build(editor)); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		if got := editor.GetContent(); got != tt.content {
+			t.Errorf("%s: content = %q, want %q", tt.name, got, tt.content)
+		}
+		if err := invoker.UndoLastCommand(); err != nil {
+			t.Fatalf("%s: undo: %v", tt.name, err)
+		}
+		if got := editor.GetContent(); got != tt.undone {
+			t.Errorf("%s: after one undo = %q, want %q", tt.name, got, tt.undone)
+		}
+		// やり直すとまとめた分がすべて戻る
+		invoker.RedoLastCommand()
+		if got := editor.GetContent(); got != tt.content {
+			t.Errorf("%s: after redo = %q, want %q", tt.name, got, tt.content)
+		}
+	}
+}
+
+// 取り消した枝が残っているノードや保存した時点のノードには結合しない
+func TestCoalescingKeepsBranchesAndSavePoints(t *testing.T) {
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithCoalescing(time.Hour))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+	invoker.ExecuteCommand(NewInsertCommand(editor, 1, "b"))
+	invoker.UndoLastCommand()
+	invoker.ExecuteCommand(NewWriteCommand(editor, "c"))
+	if got := len(invoker.UndoTree()); got != 4 {
+		t.Errorf("%d nodes after typing over an undone insert, want 4", got)
+	}
+
+	invoker.MarkSaved()
+	invoker.ExecuteCommand(NewWriteCommand(editor, "d"))
+	if !invoker.IsDirty() {
+		t.Error("typing after a save was merged into the saved node")
+	}
+	invoker.UndoLastCommand()
+	if got := editor.GetContent(); got != "ac" || invoker.IsDirty() {
+		t.Errorf("after undo: %q, dirty %v", got, invoker.IsDirty())
+	}
+	invoker.UndoLastCommand()
+	if got := editor.GetContent(); got != "a" {
+		t.Errorf("after undoing the write over the branch: %q, want %q", got, "a")
+	}
+}
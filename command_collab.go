@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// collabServerID は CollabNetwork 上でサーバーを表す番号。サイトは 1 から順に番号を振る。
+const collabServerID = 0
+
+// collabLink は送信元から送信先への1方向の通信路。届く順番は送った順番のまま。
+type collabLink struct {
+	from, to int
+	pending  []func()
+}
+
+// CollabNetwork はメッセージをすぐには届けず、DeliverOne や Flush を呼ぶまで溜めておくメモリ上のネットワーク。
+// 通信路ごとの順序は守りつつ、通信路をまたいだ到着順を入れ替えて遅延を再現できる。
+type CollabNetwork struct {
+	links []*collabLink
+}
+
+func (n *CollabNetwork) send(from, to int, deliver func()) {
+	for _, link := range n.links {
+		if link.from == from && link.to == to {
+			link.pending = append(link.pending, deliver)
+			return
+		}
+	}
+	n.links = append(n.links, &collabLink{from: from, to: to, pending: []func(){deliver}})
+}
+
+// Pending はまだ届いていないメッセージの数を返す
+func (n *CollabNetwork) Pending() int {
+	count := 0
+	for _, link := range n.links {
+		count += len(link.pending)
+	}
+	return count
+}
+
+// DeliverOne は r で選んだ通信路の先頭のメッセージを1つ届ける。r が nil なら最初の通信路を選ぶ。
+// 届けるものがなければ false を返す。
+func (n *CollabNetwork) DeliverOne(r *rand.Rand) bool {
+	ready := make([]*collabLink, 0, len(n.links))
+	for _, link := range n.links {
+		if len(link.pending) > 0 {
+			ready = append(ready, link)
+		}
+	}
+	if len(ready) == 0 {
+		return false
+	}
+	link := ready[0]
+	if r != nil {
+		link = ready[r.Intn(len(ready))]
+	}
+	deliver := link.pending[0]
+	link.pending = link.pending[1:]
+	deliver()
+	return true
+}
+
+// Flush は届けたメッセージから新たに送られたものも含め、すべて届け終えるまで配送を続ける
+func (n *CollabNetwork) Flush() {
+	for n.DeliverOne(nil) {
+	}
+}
+
+// CollabServer は文書の正本と、受け付けた順の操作履歴を持つ中央サーバー。
+// 古いリビジョンを前提にした操作は、その後に受け付けた操作に対して変換してから適用する。
+type CollabServer struct {
+	document string
+	history  []*TextOperation
+	sites    []*CollabSite
+	network  *CollabNetwork
+}
+
+func NewCollabServer(document string) *CollabServer {
+	return &CollabServer{document: document, network: &CollabNetwork{}}
+}
+
+func (s *CollabServer) Document() string {
+	return s.document
+}
+
+// Revision はこれまでに受け付けた操作の数を返す
+func (s *CollabServer) Revision() int {
+	return len(s.history)
+}
+
+func (s *CollabServer) Network() *CollabNetwork {
+	return s.network
+}
+
+// Join は editor を共同編集に参加させる。editor の内容はサーバーの文書で置き換えられ、
+// 以降コマンドなどで editor に加えた変更は操作としてサーバーに送られる。
+func (s *CollabServer) Join(editor *TextEditor) *CollabSite {
+	editor.SetContent(s.document)
+	site := &CollabSite{
+		id:       len(s.sites) + 1,
+		editor:   editor,
+		server:   s,
+		revision: len(s.history),
+	}
+	s.sites = append(s.sites, site)
+	editor.listeners = append(editor.listeners, site.onLocalEdit)
+	return site
+}
+
+func (s *CollabServer) receive(site *CollabSite, revision int, op *TextOperation) {
+	if revision < 0 || revision > len(s.history) {
+		site.fail(fmt.Errorf("collab: site %d sent unknown revision %d", site.id, revision))
+		return
+	}
+	for _, concurrent := range s.history[revision:] {
+		transformed, _, err := TransformOperations(op, concurrent)
+		if err != nil {
+			site.fail(err)
+			return
+		}
+		op = transformed
+	}
+	document, err := op.Apply(s.document)
+	if err != nil {
+		site.fail(err)
+		return
+	}
+	s.document = document
+	s.history = append(s.history, op)
+
+	for _, other := range s.sites {
+		if other == site {
+			s.network.send(collabServerID, other.id, other.acknowledge)
+			continue
+		}
+		other := other
+		s.network.send(collabServerID, other.id, func() { other.receive(op) })
+	}
+}
+
+// CollabSite は共同編集に参加している1つの TextEditor。
+// 確認待ちの操作を1つだけ送り、その間の変更は buffer にまとめておく。
+type CollabSite struct {
+	id       int
+	editor   *TextEditor
+	server   *CollabServer
+	revision int
+	// outstanding は送信済みでサーバーの確認を待っている操作
+	outstanding *TextOperation
+	// buffer は確認待ちの間に加えた、まだ送っていない変更
+	buffer *TextOperation
+	// remote はサーバーから届いた操作を適用している間 true になり、その変更を送り返さないようにする
+	remote bool
+	err    error
+}
+
+func (cs *CollabSite) Editor() *TextEditor {
+	return cs.editor
+}
+
+// Revision はこのサイトが反映済みのサーバーのリビジョンを返す
+func (cs *CollabSite) Revision() int {
+	return cs.revision
+}
+
+// Synchronized は送信済み・未送信の変更がどちらも残っていないかどうかを返す
+func (cs *CollabSite) Synchronized() bool {
+	return cs.outstanding == nil && cs.buffer == nil
+}
+
+// Err は同期中に起きた最初のエラーを返す。エラーが起きたサイトの内容は他と一致しなくなる。
+func (cs *CollabSite) Err() error {
+	return cs.err
+}
+
+func (cs *CollabSite) fail(err error) {
+	if cs.err == nil {
+		cs.err = err
+	}
+}
+
+func (cs *CollabSite) onLocalEdit(edit textEdit, baseLength int) {
+	if cs.remote {
+		return
+	}
+	op := operationFromEdit(edit, baseLength)
+	switch {
+	case cs.outstanding == nil:
+		cs.outstanding = op
+		cs.send(op)
+	case cs.buffer == nil:
+		cs.buffer = op
+	default:
+		composed, err := cs.buffer.Compose(op)
+		if err != nil {
+			cs.fail(err)
+			return
+		}
+		cs.buffer = composed
+	}
+}
+
+func (cs *CollabSite) send(op *TextOperation) {
+	revision := cs.revision
+	cs.server.network.send(cs.id, collabServerID, func() { cs.server.receive(cs, revision, op) })
+}
+
+func (cs *CollabSite) acknowledge() {
+	cs.revision++
+	cs.outstanding, cs.buffer = cs.buffer, nil
+	if cs.outstanding != nil {
+		cs.send(cs.outstanding)
+	}
+}
+
+// receive は他のサイトの操作を、まだサーバーに届いていない自分の変更に対して変換してから適用する
+func (cs *CollabSite) receive(op *TextOperation) {
+	cs.revision++
+	var err error
+	if cs.outstanding != nil {
+		if cs.outstanding, op, err = TransformOperations(cs.outstanding, op); err != nil {
+			cs.fail(err)
+			return
+		}
+	}
+	if cs.buffer != nil {
+		if cs.buffer, op, err = TransformOperations(cs.buffer, op); err != nil {
+			cs.fail(err)
+			return
+		}
+	}
+
+	cs.remote = true
+	defer func() { cs.remote = false }()
+	// 他のサイトの変更は自分の取り消し履歴には積まない。変更ログには残るので、
+	// 自分のコマンドを取り消すときはこの変更に合わせて位置をずらしてから打ち消す。
+	if _, err := cs.editor.apply(op.edits(cs.editor.text)); err != nil {
+		cs.fail(errors.Join(errors.New("collab: remote operation could not be applied"), err))
+	}
+}
+
+func ExecCollaboration() {
+	fmt.Println("=== Collaborative Editing Demo ===")
+
+	server := NewCollabServer("Hello World")
+	alice, bob := NewTextEditor(), NewTextEditor()
+	aliceSite, bobSite := server.Join(alice), server.Join(bob)
+	aliceInvoker, bobInvoker := NewCommandInvoker(), NewCommandInvoker()
+
+	fmt.Println("\n--- 同時に編集（まだ届いていない） ---")
+	aliceInvoker.ExecuteCommand(NewReplaceCommand(alice, "World", "Go"))
+	bobInvoker.ExecuteCommand(NewInsertCommand(bob, 0, ">> "))
+	bobInvoker.ExecuteCommand(NewWriteCommand(bob, "!"))
+	fmt.Printf("Alice: %q\n", alice.GetContent())
+	fmt.Printf("Bob:   %q\n", bob.GetContent())
+	fmt.Printf("未配送のメッセージ: %d\n", server.Network().Pending())
+
+	fmt.Println("\n--- ランダムな順番で配送 ---")
+	r := rand.New(rand.NewSource(1))
+	for server.Network().DeliverOne(r) {
+	}
+	fmt.Printf("サーバー: %q (リビジョン %d)\n", server.Document(), server.Revision())
+	fmt.Printf("Alice: %q\n", alice.GetContent())
+	fmt.Printf("Bob:   %q\n", bob.GetContent())
+
+	fmt.Println("\n--- Alice が取り消す ---")
+	aliceInvoker.UndoLastCommand()
+	server.Network().Flush()
+	fmt.Printf("Alice: %q\n", alice.GetContent())
+	fmt.Printf("Bob:   %q\n", bob.GetContent())
+	fmt.Printf("同期済み: %v / %v\n", aliceSite.Synchronized(), bobSite.Synchronized())
+
+	fmt.Println("\n=== Demo completed ===")
+}
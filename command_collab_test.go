@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestCollabUndoAfterRemoteEdit(t *testing.T) {
+	server := NewCollabServer("xx")
+	alice, bob := NewTextEditor(), NewTextEditor()
+	server.Join(alice)
+	server.Join(bob)
+	aliceInvoker, bobInvoker := NewCommandInvoker(), NewCommandInvoker()
+
+	aliceInvoker.ExecuteCommand(NewInsertCommand(alice, 1, "y"))
+	bobInvoker.ExecuteCommand(NewInsertCommand(bob, 0, "y"))
+	server.Network().Flush()
+	if got := alice.GetContent(); got != "yxyx" {
+		t.Fatalf("after sync: alice = %q, want %q", got, "yxyx")
+	}
+
+	if err := aliceInvoker.UndoLastCommand(); err != nil {
+		t.Fatalf("UndoLastCommand: %v", err)
+	}
+	server.Network().Flush()
+	for name, got := range map[string]string{
+		"alice":  alice.GetContent(),
+		"bob":    bob.GetContent(),
+		"server": server.Document(),
+	} {
+		if got != "yxx" {
+			t.Errorf("after undo: %s = %q, want %q", name, got, "yxx")
+		}
+	}
+}
+
+// 配送を遅らせて順番を入れ替えても、取り消し・やり直しを含めて全員の内容がサーバーと一致する
+func TestCollabConvergesWithDelayedDelivery(t *testing.T) {
+	for seed := int64(1); seed <= 100; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		server := NewCollabServer("Hello World")
+		sites := make([]*CollabSite, 3)
+		invokers := make([]*CommandInvoker, len(sites))
+		for i := range sites {
+			sites[i] = server.Join(NewTextEditor())
+			invokers[i] = NewCommandInvoker()
+		}
+
+		for step := 0; step < 80; step++ {
+			i := r.Intn(len(sites))
+			editor, invoker := sites[i].Editor(), invokers[i]
+			switch r.Intn(6) {
+			case 0:
+				invoker.ExecuteCommand(NewInsertCommand(editor, r.Intn(editor.Length()+1), fmt.Sprint(step)))
+			case 1:
+				if length := editor.Length(); length > 0 {
+					start := r.Intn(length)
+					invoker.ExecuteCommand(NewDeleteRangeCommand(editor, start, min(length, start+1+r.Intn(3))))
+				}
+			case 2:
+				invoker.ExecuteCommand(NewWriteCommand(editor, "!"))
+			case 3:
+				// 取り消す文字列が他のサイトに書き換えられていれば ErrEditConflict になるが、内容は一致したままになる
+				_ = invoker.UndoLastCommand()
+			case 4:
+				_ = invoker.RedoLastCommand()
+			default:
+				for n := r.Intn(4); n > 0; n-- {
+					server.Network().DeliverOne(r)
+				}
+			}
+		}
+		server.Network().Flush()
+
+		for i, site := range sites {
+			if err := site.Err(); err != nil {
+				t.Fatalf("seed %d: site %d: %v", seed, i+1, err)
+			}
+			if !site.Synchronized() {
+				t.Errorf("seed %d: site %d is not synchronized", seed, i+1)
+			}
+			if got, want := site.Editor().GetContent(), server.Document(); got != want {
+				t.Fatalf("seed %d: site %d = %q, server = %q", seed, i+1, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrOutOfRange = errors.New("position out of range")
+
+// cursorState はカーソル位置と選択範囲の起点（バイト位置）。anchor == cursor のとき選択なし。
+type cursorState struct {
+	anchor int
+	cursor int
+}
+
+func (te *TextEditor) GetCursor() int {
+	return te.toUnit(te.cursor)
+}
+
+// GetSelection は選択範囲を start <= end の順で返す
+func (te *TextEditor) GetSelection() (int, int) {
+	start, end := te.selectionBytes()
+	return te.toUnit(start), te.toUnit(end)
+}
+
+func (te *TextEditor) HasSelection() bool {
+	return te.anchor != te.cursor
+}
+
+func (te *TextEditor) SelectedText() string {
+	start, end := te.selectionBytes()
+	return te.text.Slice(start, end)
+}
+
+// MoveCursor はカーソルを pos に移動し、選択を解除する
+func (te *TextEditor) MoveCursor(pos int) error {
+	return te.Select(pos, pos)
+}
+
+// Select は start から end までを選択し、カーソルを end に置く
+func (te *TextEditor) Select(start, end int) error {
+	state, err := te.cursorStateAt(start, end)
+	if err != nil {
+		return err
+	}
+	te.setCursorState(state)
+	return nil
+}
+
+func (te *TextEditor) InsertAt(pos int, text string) error {
+	edits, err := te.insertEdits(pos, text)
+	if err != nil {
+		return err
+	}
+	return te.applyEdits(edits)
+}
+
+func (te *TextEditor) DeleteRange(start, end int) error {
+	edits, err := te.deleteRangeEdits(start, end)
+	if err != nil {
+		return err
+	}
+	return te.applyEdits(edits)
+}
+
+// ReplaceSelection は選択範囲を text に置き換え、カーソルを置き換えた文字列の直後に置く。
+// 選択がない場合はカーソル位置に挿入する。
+func (te *TextEditor) ReplaceSelection(text string) error {
+	edits := te.replaceSelectionEdits(text)
+	if err := te.applyEdits(edits); err != nil {
+		return err
+	}
+	te.placeAfter(edits[0])
+	return nil
+}
+
+func (te *TextEditor) selectionBytes() (int, int) {
+	if te.anchor <= te.cursor {
+		return te.anchor, te.cursor
+	}
+	return te.cursor, te.anchor
+}
+
+func (te *TextEditor) cursorState() cursorState {
+	return cursorState{anchor: te.anchor, cursor: te.cursor}
+}
+
+// cursorStateAt は unit 単位の anchor, cursor をバイト位置の cursorState に変換する
+func (te *TextEditor) cursorStateAt(anchor, cursor int) (cursorState, error) {
+	a, err := te.toByte(anchor)
+	if err != nil {
+		return cursorState{}, err
+	}
+	c, err := te.toByte(cursor)
+	if err != nil {
+		return cursorState{}, err
+	}
+	return cursorState{anchor: a, cursor: c}, nil
+}
+
+func (te *TextEditor) setCursorState(state cursorState) {
+	te.anchor = state.anchor
+	te.cursor = state.cursor
+	te.clampCursor()
+}
+
+// clampCursor はカーソルと選択の起点を内容の範囲内かつ文字の区切りに収める
+func (te *TextEditor) clampCursor() {
+	te.cursor = te.snap(te.cursor)
+	te.anchor = te.snap(te.anchor)
+}
+
+func (te *TextEditor) snap(b int) int {
+	if b > te.text.Len() {
+		return te.text.Len()
+	}
+	for b > 0 && !te.text.IsBoundary(te.unit, b) {
+		b--
+	}
+	return b
+}
+
+func (te *TextEditor) toByte(pos int) (int, error) {
+	b, ok := te.text.ByteOffset(te.unit, pos)
+	if !ok {
+		return 0, fmt.Errorf("%w: %d (length %d)", ErrOutOfRange, pos, te.Length())
+	}
+	return b, nil
+}
+
+func (te *TextEditor) toUnit(b int) int {
+	return te.text.Count(te.unit, b)
+}
+
+func (te *TextEditor) insertEdits(pos int, text string) ([]textEdit, error) {
+	b, err := te.toByte(pos)
+	if err != nil {
+		return nil, err
+	}
+	return []textEdit{{pos: b, inserted: text}}, nil
+}
+
+func (te *TextEditor) deleteRangeEdits(start, end int) ([]textEdit, error) {
+	if start > end {
+		return nil, fmt.Errorf("%w: %d-%d", ErrOutOfRange, start, end)
+	}
+	s, err := te.toByte(start)
+	if err != nil {
+		return nil, err
+	}
+	e, err := te.toByte(end)
+	if err != nil {
+		return nil, err
+	}
+	return []textEdit{{pos: s, removed: te.text.Slice(s, e)}}, nil
+}
+
+// placeAfter は選択を解除し、edit で挿入した文字列の直後にカーソルを置く。
+// カーソルが選択範囲の先頭側にあっても、置き換えた後は末尾に移る。
+func (te *TextEditor) placeAfter(edit textEdit) {
+	te.cursor = edit.pos + len(edit.inserted)
+	te.anchor = te.cursor
+}
+
+func (te *TextEditor) replaceSelectionEdits(text string) []textEdit {
+	start, end := te.selectionBytes()
+	return []textEdit{{pos: start, removed: te.text.Slice(start, end), inserted: text}}
+}
+
+type InsertCommand struct {
+	editor *TextEditor
+	pos    int
+	text   string
+	record *editRecord
+}
+
+func NewInsertCommand(editor *TextEditor, pos int, text string) *InsertCommand {
+	return &InsertCommand{
+		editor: editor,
+		pos:    pos,
+		text:   text,
+	}
+}
+
+func (ic *InsertCommand) Execute() error {
+	edits, err := ic.editor.insertEdits(ic.pos, ic.text)
+	if err != nil {
+		return err
+	}
+	record, err := ic.editor.record(edits)
+	if err != nil {
+		return err
+	}
+	ic.record = record
+	return nil
+}
+
+func (ic *InsertCommand) Undo() error {
+	return ic.editor.revertEdits(ic.record)
+}
+
+func (ic *InsertCommand) GetDescription() string {
+	return fmt.Sprintf("Insert: \"%s\" @%d", ic.text, ic.pos)
+}
+
+type DeleteRangeCommand struct {
+	editor *TextEditor
+	start  int
+	end    int
+	record *editRecord
+}
+
+func NewDeleteRangeCommand(editor *TextEditor, start, end int) *DeleteRangeCommand {
+	return &DeleteRangeCommand{
+		editor: editor,
+		start:  start,
+		end:    end,
+	}
+}
+
+func (dc *DeleteRangeCommand) Execute() error {
+	edits, err := dc.editor.deleteRangeEdits(dc.start, dc.end)
+	if err != nil {
+		return err
+	}
+	record, err := dc.editor.record(edits)
+	if err != nil {
+		return err
+	}
+	dc.record = record
+	return nil
+}
+
+func (dc *DeleteRangeCommand) Undo() error {
+	return dc.editor.revertEdits(dc.record)
+}
+
+func (dc *DeleteRangeCommand) GetDescription() string {
+	return fmt.Sprintf("DeleteRange: %d-%d", dc.start, dc.end)
+}
+
+// MoveCursorCommand はカーソル移動・範囲選択を取り消し可能にする
+type MoveCursorCommand struct {
+	editor   *TextEditor
+	anchor   int
+	cursor   int
+	previous cursorState
+}
+
+func NewMoveCursorCommand(editor *TextEditor, pos int) *MoveCursorCommand {
+	return &MoveCursorCommand{
+		editor: editor,
+		anchor: pos,
+		cursor: pos,
+	}
+}
+
+func NewSelectCommand(editor *TextEditor, start, end int) *MoveCursorCommand {
+	return &MoveCursorCommand{
+		editor: editor,
+		anchor: start,
+		cursor: end,
+	}
+}
+
+func (mc *MoveCursorCommand) Execute() error {
+	target, err := mc.editor.cursorStateAt(mc.anchor, mc.cursor)
+	if err != nil {
+		return err
+	}
+	mc.previous = mc.editor.cursorState()
+	mc.editor.setCursorState(target)
+	return nil
+}
+
+func (mc *MoveCursorCommand) Undo() error {
+	mc.editor.setCursorState(mc.previous)
+	return nil
+}
+
+func (mc *MoveCursorCommand) GetDescription() string {
+	if mc.anchor == mc.cursor {
+		return fmt.Sprintf("MoveCursor: %d", mc.cursor)
+	}
+	return fmt.Sprintf("Select: %d-%d", mc.anchor, mc.cursor)
+}
+
+type ReplaceSelectionCommand struct {
+	editor   *TextEditor
+	text     string
+	record   *editRecord
+	previous cursorState
+}
+
+func NewReplaceSelectionCommand(editor *TextEditor, text string) *ReplaceSelectionCommand {
+	return &ReplaceSelectionCommand{
+		editor: editor,
+		text:   text,
+	}
+}
+
+func (rc *ReplaceSelectionCommand) Execute() error {
+	previous := rc.editor.cursorState()
+	record, err := rc.editor.record(rc.editor.replaceSelectionEdits(rc.text))
+	if err != nil {
+		return err
+	}
+	rc.editor.placeAfter(record.edits[0])
+	rc.record = record
+	rc.previous = previous
+	return nil
+}
+
+// Undo は置き換えを戻し、実行前の選択範囲を（内容の範囲内に収めて）復元する
+func (rc *ReplaceSelectionCommand) Undo() error {
+	if err := rc.editor.revertEdits(rc.record); err != nil {
+		return err
+	}
+	rc.editor.setCursorState(rc.previous)
+	return nil
+}
+
+func (rc *ReplaceSelectionCommand) GetDescription() string {
+	return fmt.Sprintf("ReplaceSelection: \"%s\"", rc.text)
+}
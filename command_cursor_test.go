@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCursorCommandsRejectOutOfRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(editor *TextEditor) Command
+	}{
+		{"insert past the end", func(e *TextEditor) Command { return NewInsertCommand(e, 6, "x") }},
+		{"insert before the start", func(e *TextEditor) Command { return NewInsertCommand(e, -1, "x") }},
+		{"delete reversed range", func(e *TextEditor) Command { return NewDeleteRangeCommand(e, 3, 1) }},
+		{"delete past the end", func(e *TextEditor) Command { return NewDeleteRangeCommand(e, 2, 6) }},
+		{"move past the end", func(e *TextEditor) Command { return NewMoveCursorCommand(e, 6) }},
+		{"select before the start", func(e *TextEditor) Command { return NewSelectCommand(e, -1, 2) }},
+		{"select past the end", func(e *TextEditor) Command { return NewSelectCommand(e, 0, 9) }},
+	}
+	for _, tt := range tests {
+		editor := NewTextEditor()
+		editor.SetContent("Hello")
+		editor.Select(1, 3)
+		invoker := NewCommandInvoker()
+		if err := invoker.ExecuteCommand(tt.build(editor)); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("%s: error = %v, want ErrOutOfRange", tt.name, err)
+		}
+		start, end := editor.GetSelection()
+		if editor.GetContent() != "Hello" || start != 1 || end != 3 || invoker.CanUndo() {
+			t.Errorf("%s: content %q, selection %d-%d, undoable %v after a failed command",
+				tt.name, editor.GetContent(), start, end, invoker.CanUndo())
+		}
+	}
+}
+
+// 選択したあとに内容が変わると、選択範囲は同じ文字列を指すようにずれ、消えた分は縮む
+func TestSelectionFollowsEdits(t *testing.T) {
+	editor := NewTextEditor()
+	editor.SetContent("Hello")
+	invoker := NewCommandInvoker()
+	invoker.ExecuteCommand(NewSelectCommand(editor, 1, 4))
+
+	steps := []struct {
+		name       string
+		command    Command
+		start, end int
+		selected   string
+	}{
+		{"insert before", NewInsertCommand(editor, 0, "ab"), 3, 6, "ell"},
+		{"insert after", NewInsertCommand(editor, 7, "!"), 3, 6, "ell"},
+		{"delete overlapping the start", NewDeleteRangeCommand(editor, 0, 4), 0, 2, "ll"},
+		{"replace selection", NewReplaceSelectionCommand(editor, "LL"), 2, 2, ""},
+		{"clear", NewClearCommand(editor), 0, 0, ""},
+	}
+	for _, step := range steps {
+		if err := invoker.ExecuteCommand(step.command); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		start, end := editor.GetSelection()
+		if start != step.start || end != step.end || editor.SelectedText() != step.selected {
+			t.Errorf("%s: selection %d-%d %q, want %d-%d %q",
+				step.name, start, end, editor.SelectedText(), step.start, step.end, step.selected)
+		}
+	}
+}
+
+func TestUndoRestoresCursorAndSelection(t *testing.T) {
+	editor := NewTextEditor()
+	editor.SetContent("Hello")
+	editor.MoveCursor(0)
+	invoker := NewCommandInvoker()
+	invoker.ExecuteCommand(NewMoveCursorCommand(editor, 5))
+	invoker.ExecuteCommand(NewSelectCommand(editor, 3, 1))
+	invoker.ExecuteCommand(NewReplaceSelectionCommand(editor, "XYZ"))
+	if got := editor.GetContent(); got != "HXYZlo" {
+		t.Fatalf("content = %q, want %q", got, "HXYZlo")
+	}
+	if editor.HasSelection() || editor.GetCursor() != 4 {
+		t.Errorf("after replace: cursor %d, selection %v", editor.GetCursor(), editor.HasSelection())
+	}
+
+	states := []struct {
+		content    string
+		start, end int
+		cursor     int
+	}{
+		{"Hello", 1, 3, 1},
+		{"Hello", 5, 5, 5},
+		{"Hello", 0, 0, 0},
+	}
+	for _, want := range states {
+		if err := invoker.UndoLastCommand(); err != nil {
+			t.Fatal(err)
+		}
+		start, end := editor.GetSelection()
+		if editor.GetContent() != want.content || start != want.start || end != want.end || editor.GetCursor() != want.cursor {
+			t.Errorf("after undo: %q selection %d-%d cursor %d, want %q %d-%d cursor %d",
+				editor.GetContent(), start, end, editor.GetCursor(), want.content, want.start, want.end, want.cursor)
+		}
+	}
+}
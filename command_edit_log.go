@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// editSpan は変更の位置と、削除・挿入したバイト数
+type editSpan struct {
+	pos      int
+	removed  int
+	inserted int
+}
+
+func (e textEdit) span() editSpan {
+	return editSpan{pos: e.pos, removed: len(e.removed), inserted: len(e.inserted)}
+}
+
+// editLogEntry はエディタが適用した変更1回分の記録。文字列は持たず、位置と長さだけを残す。
+type editLogEntry struct {
+	editSpan
+	// group はこの変更を記録した editRecord の start
+	group int
+	// reverted はこの変更を記録した editRecord が、後で取り消されたかどうか
+	reverted bool
+	// undoes は editRecord を取り消すために適用した変更なら、その記録の start。それ以外は -1。
+	undoes int
+}
+
+// editRecord はコマンドなどが適用した変更の列と、その変更が変更ログに占める範囲 [start, end)。
+// 取り消すときは end 以降に適用された変更に合わせて位置を更新するので、
+// 間に他の編集が入っていても、記録した変更そのものを打ち消せる。
+type editRecord struct {
+	edits []textEdit
+	start int
+	end   int
+	// released は取り消したか、履歴から捨てたために変更ログを参照しなくなったかどうか
+	released bool
+}
+
+func (r *editRecord) size() int {
+	if r == nil {
+		return 0
+	}
+	return editsSize(r.edits)
+}
+
+// defaultEditLogLimit は変更ログに残す変更の既定の上限
+const defaultEditLogLimit = 1 << 16
+
+// WithEditLogLimit は変更ログに残す変更を最大 n 件にする。0 は無制限。
+// 取り消されないまま n 件より前になった記録は、ログから外れて取り消せなくなる。
+// 呼び出し側が release しない記録（invoker を通さずに実行したコマンドなど）があっても、ログはこの件数で頭打ちになる。
+func WithEditLogLimit(n int) EditorOption {
+	return func(te *TextEditor) {
+		te.logLimit = n
+	}
+}
+
+// changeCount はこれまでに変更ログへ記録した変更の数を返す
+func (te *TextEditor) changeCount() int {
+	return te.changeBase + len(te.changes)
+}
+
+// logChange は適用した edit を変更ログに記録する。どの記録も参照していないログは先に捨てる。
+func (te *TextEditor) logChange(edit textEdit, group, undoes int) {
+	if len(te.pins) == 0 {
+		te.changeBase += len(te.changes)
+		te.changes = te.changes[:0]
+	}
+	te.changes = append(te.changes, editLogEntry{editSpan: edit.span(), group: group, undoes: undoes})
+}
+
+// limitLog は変更ログが logLimit を超えていれば、古い方から半分ほどを捨てる。
+// 適用に失敗したときにログを巻き戻せるよう、変更をすべて適用し終えてから呼ぶ。
+func (te *TextEditor) limitLog() {
+	if te.logLimit > 0 && len(te.changes) > te.logLimit {
+		te.expire(te.changeCount() - te.logLimit/2)
+	}
+}
+
+// expire は通し番号 base より前の変更ログを捨てる。それより前で終わる記録は取り消せなくなる。
+func (te *TextEditor) expire(base int) {
+	for end := range te.pins {
+		if end < base {
+			delete(te.pins, end)
+		}
+	}
+	te.changes = slices.Clone(te.changes[base-te.changeBase:])
+	te.changeBase = base
+	te.trimAt = max(2*len(te.changes), 256)
+}
+
+// record は edits を適用し、後で revertEdits で取り消すための記録を返す
+func (te *TextEditor) record(edits []textEdit) (*editRecord, error) {
+	start := te.changeCount()
+	applied, err := te.apply(edits)
+	if err != nil {
+		return nil, err
+	}
+	record := &editRecord{edits: applied, start: start, end: te.changeCount()}
+	if te.pins == nil {
+		te.pins = make(map[int]int)
+	}
+	te.pins[record.end]++
+	return record, nil
+}
+
+// revertEdits は record の変更を現在の位置に写してから逆順に打ち消す。
+// 打ち消す文字列が他の編集で書き換えられていれば、何も変更せずに ErrEditConflict を返す。
+// record の後の変更がすでに変更ログから外れていれば ErrEditExpired を返す。
+func (te *TextEditor) revertEdits(record *editRecord) error {
+	if record == nil || record.released {
+		return nil
+	}
+	if record.end < te.changeBase {
+		return fmt.Errorf("%w: edit %d, log starts at %d", ErrEditExpired, record.end, te.changeBase)
+	}
+	edits, err := te.rebase(record)
+	if err != nil {
+		return err
+	}
+	if _, err := te.applyChanges(invertEdits(edits), record.start); err != nil {
+		return err
+	}
+	for i := max(record.start, te.changeBase); i < record.end; i++ {
+		te.changes[i-te.changeBase].reverted = true
+	}
+	record.edits = edits
+	te.release(record)
+	return nil
+}
+
+// mergeRecords は続けて適用した記録 a と b を、edits を適用した1つの記録にまとめる
+func (te *TextEditor) mergeRecords(a, b *editRecord, edits []textEdit) *editRecord {
+	for i := max(b.start, te.changeBase); i < b.end; i++ {
+		te.changes[i-te.changeBase].group = a.start
+	}
+	te.release(a)
+	return &editRecord{edits: edits, start: a.start, end: b.end}
+}
+
+// release は record を取り消しに使わなくなったことを伝える。
+// どの記録からも参照されなくなった変更ログは、ある程度たまったところでまとめて捨てる。
+func (te *TextEditor) release(record *editRecord) {
+	if record == nil || record.released {
+		return
+	}
+	record.released = true
+	if te.pins[record.end]--; te.pins[record.end] <= 0 {
+		delete(te.pins, record.end)
+	}
+	if len(te.changes) < te.trimAt {
+		return
+	}
+	oldest := te.changeCount()
+	for end := range te.pins {
+		oldest = min(oldest, end)
+	}
+	te.expire(oldest)
+}
+
+// pendingGroup は rebase 中の記録より後に適用され、その後で取り消された記録の変更
+type pendingGroup struct {
+	group int
+	spans []editSpan
+	// undone は取り消しの変更まで読み進めたかどうか
+	undone bool
+}
+
+// rebase は record の変更を、record より後に変更ログへ記録された変更に合わせて現在の位置に写す。
+// 後で取り消された記録の変更とその取り消しは打ち消し合うので、間の変更はその記録を除いた位置に写してから反映する。
+func (te *TextEditor) rebase(record *editRecord) ([]textEdit, error) {
+	spans := make([]editSpan, len(record.edits))
+	for i, edit := range record.edits {
+		spans[i] = edit.span()
+	}
+	var pending []*pendingGroup
+	for _, entry := range te.changes[record.end-te.changeBase:] {
+		pending = slices.DeleteFunc(pending, func(g *pendingGroup) bool {
+			return g.undone && g.group != entry.undoes
+		})
+		if entry.reverted {
+			if n := len(pending); n > 0 && pending[n-1].group == entry.group {
+				pending[n-1].spans = append(pending[n-1].spans, entry.editSpan)
+			} else {
+				pending = append(pending, &pendingGroup{group: entry.group, spans: []editSpan{entry.editSpan}})
+			}
+			continue
+		}
+		x := entry.editSpan
+		// 取り消しの変更は、取り消した記録より後に適用された pending にだけ反映する
+		above := 0
+		if i := slices.IndexFunc(pending, func(g *pendingGroup) bool { return g.group == entry.undoes }); i >= 0 {
+			pending[i].undone = true
+			above = i + 1
+		}
+		for i := len(pending) - 1; i >= above; i-- {
+			var ok bool
+			if x, ok = rebaseSpans(pending[i].spans, x); !ok {
+				return nil, fmt.Errorf("%w: undone edit overlaps a later edit", ErrEditConflict)
+			}
+		}
+		if above > 0 {
+			continue
+		}
+		if _, ok := rebaseSpans(spans, x); !ok {
+			return nil, fmt.Errorf("%w: %q was changed by a later edit", ErrEditConflict, record.edits[len(record.edits)-1].inserted)
+		}
+	}
+	edits := slices.Clone(record.edits)
+	for i := range edits {
+		edits[i].pos = spans[i].pos
+	}
+	return edits, nil
+}
+
+// rebaseSpans は spans（順に適用済み）の後に適用された x に合わせて spans の位置を更新し、
+// x を spans を適用する前の位置に写して返す。x が spans で挿入した範囲を書き換えていれば false を返す。
+// spans の挿入位置ちょうどへの挿入は前に、挿入した範囲の直後への挿入は後ろに入ったものとみなす。
+func rebaseSpans(spans []editSpan, x editSpan) (editSpan, bool) {
+	for i := len(spans) - 1; i >= 0; i-- {
+		s := &spans[i]
+		switch {
+		case x.pos+x.removed <= s.pos:
+			s.pos += x.inserted - x.removed
+		case x.pos >= s.pos+s.inserted:
+			x.pos -= s.inserted - s.removed
+		default:
+			return x, false
+		}
+	}
+	return x, true
+}
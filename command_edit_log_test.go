@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// 取り消す前に同じ文字列を直接挿入しても、コマンドが置き換えた箇所だけを戻す
+func TestUndoAfterDirectEdit(t *testing.T) {
+	editor := NewTextEditor()
+	editor.SetContent("cat dog")
+	invoker := NewCommandInvoker()
+	invoker.ExecuteCommand(NewReplaceCommand(editor, "cat", "dog"))
+	if err := editor.InsertAt(0, "dog "); err != nil {
+		t.Fatal(err)
+	}
+	if err := invoker.UndoLastCommand(); err != nil {
+		t.Fatalf("UndoLastCommand: %v", err)
+	}
+	if got, want := editor.GetContent(), "dog cat dog"; got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+}
+
+func TestUndoAcrossInterleavedEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(editor *TextEditor, invoker *CommandInvoker)
+		want []string
+	}{
+		{
+			// 後のコマンドが前のコマンドの挿入した文字列を消していても、先に取り消されるので打ち消し合う
+			name: "later command edits inserted text",
+			run: func(editor *TextEditor, invoker *CommandInvoker) {
+				invoker.ExecuteCommand(NewWriteCommand(editor, "abc"))
+				invoker.ExecuteCommand(NewDeleteCommand(editor, 1))
+				editor.InsertAt(0, ">")
+			},
+			want: []string{">abc", ">"},
+		},
+		{
+			// コマンドの間に直接編集した分を RestorePreviousContent で先に戻す
+			name: "direct edit restored in between",
+			run: func(editor *TextEditor, invoker *CommandInvoker) {
+				invoker.ExecuteCommand(NewWriteCommand(editor, "q"))
+				editor.InsertAt(0, "h")
+				invoker.ExecuteCommand(NewInsertCommand(editor, 1, "r"))
+				editor.RestorePreviousContent()
+			},
+			want: []string{"q", ""},
+		},
+		{
+			name: "pattern replace after direct edits",
+			run: func(editor *TextEditor, invoker *CommandInvoker) {
+				editor.SetContent("a-a-a")
+				invoker.ExecuteCommand(NewPatternReplaceCommand(editor, "a", "bb"))
+				editor.InsertAt(0, "a")
+				editor.AppendText("a")
+				editor.DeleteRange(3, 4)
+			},
+			want: []string{"aaa-aa"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := NewTextEditor()
+			invoker := NewCommandInvoker()
+			tt.run(editor, invoker)
+			for _, want := range tt.want {
+				if err := invoker.UndoLastCommand(); err != nil {
+					t.Fatalf("UndoLastCommand: %v", err)
+				}
+				if got := editor.GetContent(); got != want {
+					t.Fatalf("content = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+// コマンドが挿入した文字列を書き換えられていたら、似た箇所を探さずに失敗する
+func TestUndoConflictWhenInsertedTextChanged(t *testing.T) {
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker()
+	invoker.ExecuteCommand(NewWriteCommand(editor, "abc"))
+	editor.AppendText(" abc")
+	editor.DeleteRange(1, 2)
+	err := invoker.UndoLastCommand()
+	if !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("UndoLastCommand error = %v, want ErrEditConflict", err)
+	}
+	if got, want := editor.GetContent(), "ac abc"; got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+}
+
+// 履歴から捨てたコマンドの分の変更ログは残さない
+func TestEditLogIsTrimmed(t *testing.T) {
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithHistoryLimit(3, 0))
+	for i := 0; i < 10000; i++ {
+		invoker.ExecuteCommand(NewWriteCommand(editor, "x"))
+	}
+	if got := len(editor.changes); got > 512 {
+		t.Errorf("edit log has %d entries after 10000 writes with 3 undoable", got)
+	}
+	for invoker.CanUndo() {
+		if err := invoker.UndoLastCommand(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := editor.Length(), 9997; got != want {
+		t.Errorf("length = %d, want %d", got, want)
+	}
+}
+
+// invoker を通さずに実行したコマンドは release されないが、変更ログは上限で頭打ちになる
+func TestEditLogIsBoundedWithoutInvoker(t *testing.T) {
+	editor := NewTextEditor(WithEditLogLimit(100))
+	commands := make([]*WriteCommand, 1000)
+	for i := range commands {
+		commands[i] = NewWriteCommand(editor, "x")
+		if err := commands[i].Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(editor.changes); got > 100 {
+		t.Errorf("edit log has %d entries with a limit of 100", got)
+	}
+	if got := len(editor.pins); got > 100 {
+		t.Errorf("%d pins with a limit of 100", got)
+	}
+	if err := commands[len(commands)-1].Undo(); err != nil {
+		t.Fatalf("undo the last write: %v", err)
+	}
+	if err := commands[0].Undo(); !errors.Is(err, ErrEditExpired) {
+		t.Errorf("undo the first write: error = %v, want ErrEditExpired", err)
+	}
+	if got, want := editor.Length(), 999; got != want {
+		t.Errorf("length = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var ErrNoFilePath = errors.New("editor has no file path")
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// editorFile はエディタに対応するファイルと、その改行コード・BOM の有無
+type editorFile struct {
+	path string
+	bom  bool
+	// crlf が true のとき、エディタ内では改行を "\n" で持ち、保存時に "\r\n" に戻す
+	crlf bool
+}
+
+// decodeTextFile はファイルの内容から BOM を取り除き、すべての改行が CRLF なら LF にそろえる。
+// CR と LF が混在するファイルは、保存したときに元に戻せるようそのまま扱う。
+func decodeTextFile(path string, data []byte) (string, editorFile) {
+	file := editorFile{path: path}
+	if bytes.HasPrefix(data, utf8BOM) {
+		file.bom = true
+		data = data[len(utf8BOM):]
+	}
+	content := string(data)
+	if crlf := strings.Count(content, "\r\n"); crlf > 0 && crlf == strings.Count(content, "\n") {
+		file.crlf = true
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	return content, file
+}
+
+func (f editorFile) encode(content string) []byte {
+	if f.crlf {
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	data := make([]byte, 0, len(utf8BOM)+len(content))
+	if f.bom {
+		data = append(data, utf8BOM...)
+	}
+	return append(data, content...)
+}
+
+// OpenTextEditor は path のファイルを読み込んだエディタを返す。読み込んだ内容は取り消しの対象にならない。
+func OpenTextEditor(path string, options ...EditorOption) (*TextEditor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content, file := decodeTextFile(path, data)
+	editor := NewTextEditor(options...)
+	editor.text = newPieceTable(content)
+	editor.file = file
+	return editor, nil
+}
+
+// Path は保存先のファイルを返す。ファイルに対応していなければ空文字列。
+func (te *TextEditor) Path() string {
+	return te.file.path
+}
+
+// Save は内容を読み込んだときの改行コードと BOM で、対応するファイルに書き出す
+func (te *TextEditor) Save() error {
+	if te.file.path == "" {
+		return ErrNoFilePath
+	}
+	return writeFileAtomic(te.file.path, te.file.encode(te.text.String()))
+}
+
+// SaveAs は path に保存し、以降の保存先を path にする
+func (te *TextEditor) SaveAs(path string) error {
+	file := te.file
+	file.path = path
+	if err := writeFileAtomic(path, file.encode(te.text.String())); err != nil {
+		return err
+	}
+	te.file = file
+	return nil
+}
+
+// writeFileAtomic は同じディレクトリの一時ファイルに書き込んでから名前を変えるので、
+// 途中で失敗しても元のファイルが壊れたり、書きかけの内容が残ったりしない
+func writeFileAtomic(path string, data []byte) (err error) {
+	mode := fs.FileMode(0o644)
+	if info, statErr := os.Stat(path); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// TransientCommand は実行しても取り消しの履歴に積まないコマンド
+type TransientCommand interface {
+	Command
+	Transient() bool
+}
+
+// SavePointCommand は実行後の内容がファイルと一致するコマンド。
+// CommandInvoker は実行後の位置を保存済みの状態として扱う。
+type SavePointCommand interface {
+	Command
+	SavePoint() bool
+}
+
+func (ci *CommandInvoker) markSavePoint(command Command) {
+	if savePoint, ok := command.(SavePointCommand); ok && savePoint.SavePoint() {
+		ci.saved = ci.current
+	}
+}
+
+// MarkSaved は現在位置を保存済みの状態とする
+func (ci *CommandInvoker) MarkSaved() {
+	ci.saved = ci.current
+}
+
+// IsDirty は最後に保存した時点から内容が変わっているかどうかを返す。
+// 保存した時点と現在位置の間にカーソル移動などの内容を変えないノードしかなければ、未保存の変更はない。
+// 取り消しややり直しで保存した時点に戻った場合も同じ。
+func (ci *CommandInvoker) IsDirty() bool {
+	if ci.nodes[ci.saved.id] != ci.saved {
+		// 保存した時点のノードは履歴の上限で捨てた
+		return true
+	}
+	a, b := ci.saved, ci.current
+	da, db := a.depth(), b.depth()
+	for a != b {
+		if da >= db {
+			if changesContent(a.command) {
+				return true
+			}
+			a, da = a.parent, da-1
+		} else {
+			if changesContent(b.command) {
+				return true
+			}
+			b, db = b.parent, db-1
+		}
+	}
+	return false
+}
+
+// contentCommand は内容を変えるかどうかを返せるコマンド
+type contentCommand interface {
+	changesContent() bool
+}
+
+// changesContent は command が内容を変えるかどうかを返す。わからないコマンドは変えるものとみなす。
+func changesContent(command Command) bool {
+	if c, ok := command.(contentCommand); ok {
+		return c.changesContent()
+	}
+	return true
+}
+
+func (mc *MoveCursorCommand) changesContent() bool { return false }
+
+func (mc *MacroCommand) changesContent() bool {
+	return slices.ContainsFunc(mc.commands, changesContent)
+}
+
+// SaveCommand はエディタの内容をファイルに保存する。履歴には積まない。
+type SaveCommand struct {
+	editor *TextEditor
+	path   string
+}
+
+func NewSaveCommand(editor *TextEditor) *SaveCommand {
+	return &SaveCommand{editor: editor}
+}
+
+// NewSaveAsCommand は path に保存し、以降の保存先を path にする
+func NewSaveAsCommand(editor *TextEditor, path string) *SaveCommand {
+	return &SaveCommand{editor: editor, path: path}
+}
+
+func (sc *SaveCommand) Execute() error {
+	if sc.path != "" {
+		return sc.editor.SaveAs(sc.path)
+	}
+	return sc.editor.Save()
+}
+
+// Undo は何もしない。書き出したファイルは元に戻さない。
+func (sc *SaveCommand) Undo() error {
+	return nil
+}
+
+func (sc *SaveCommand) GetDescription() string {
+	path := sc.path
+	if path == "" {
+		path = sc.editor.Path()
+	}
+	return fmt.Sprintf("Save: %s", path)
+}
+
+func (sc *SaveCommand) Transient() bool { return true }
+func (sc *SaveCommand) SavePoint() bool { return true }
+
+// RevertCommand はエディタの内容をファイルから読み直す。読み直す前の内容には取り消しで戻れる。
+// 最初に実行したときに読んだ内容を覚えておき、やり直しやジャーナルの再生ではファイルを読まずにその内容に戻す。
+type RevertCommand struct {
+	editor *TextEditor
+	// loaded が true のとき、content と file は読み直した内容と改行コード・BOM
+	loaded  bool
+	content string
+	file    editorFile
+	// previous は読み直す前の改行コード・BOM。取り消すときに戻す。
+	previous editorFile
+	record   *editRecord
+}
+
+func NewRevertCommand(editor *TextEditor) *RevertCommand {
+	return &RevertCommand{editor: editor}
+}
+
+func (rc *RevertCommand) Execute() error {
+	if !rc.loaded {
+		if rc.editor.file.path == "" {
+			return ErrNoFilePath
+		}
+		data, err := os.ReadFile(rc.editor.file.path)
+		if err != nil {
+			return err
+		}
+		rc.content, rc.file = decodeTextFile(rc.editor.file.path, data)
+		rc.loaded = true
+	}
+	record, err := rc.editor.record([]textEdit{{pos: 0, removed: rc.editor.text.String(), inserted: rc.content}})
+	if err != nil {
+		return err
+	}
+	rc.previous = rc.editor.file
+	rc.editor.file = rc.file
+	rc.record = record
+	return nil
+}
+
+// Undo は読み直す前の内容と、保存するときの改行コード・BOM を戻す
+func (rc *RevertCommand) Undo() error {
+	if err := rc.editor.revertEdits(rc.record); err != nil {
+		return err
+	}
+	rc.editor.file = rc.previous
+	return nil
+}
+
+func (rc *RevertCommand) GetDescription() string {
+	return fmt.Sprintf("Revert: %s", rc.editor.Path())
+}
+
+func (rc *RevertCommand) SavePoint() bool { return true }
+
+func (rc *RevertCommand) historySize() int { return rc.record.size() }
+func (rc *RevertCommand) release()         { rc.editor.release(rc.record) }
+
+func ExecFileEditor() {
+	fmt.Println("=== File Editor Demo ===")
+
+	dir, err := os.MkdirTemp("", "editor")
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "memo.txt")
+	os.WriteFile(path, []byte("\xEF\xBB\xBFHello World\r\nSecond line\r\n"), 0o644)
+
+	editor, err := OpenTextEditor(path)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+	invoker := NewCommandInvoker(WithMiddleware(LoggingMiddleware(os.Stdout)))
+	status := func() {
+		fmt.Printf("内容: %q 未保存: %v\n", editor.GetContent(), invoker.IsDirty())
+	}
+	status()
+
+	fmt.Println("\n--- 編集して保存 ---")
+	invoker.ExecuteCommand(NewReplaceCommand(editor, "World", "Go"))
+	status()
+	invoker.ExecuteCommand(NewSaveCommand(editor))
+	status()
+	data, _ := os.ReadFile(path)
+	fmt.Printf("ファイル: %q\n", data)
+
+	fmt.Println("\n--- 取り消すと未保存、やり直すと保存済みに戻る ---")
+	invoker.UndoLastCommand()
+	status()
+	invoker.RedoLastCommand()
+	status()
+
+	fmt.Println("\n--- 編集してからファイルの内容に戻す ---")
+	invoker.ExecuteCommand(NewClearCommand(editor))
+	status()
+	invoker.ExecuteCommand(NewRevertCommand(editor))
+	status()
+	invoker.UndoLastCommand()
+	status()
+
+	fmt.Println("\n=== Demo completed ===")
+}
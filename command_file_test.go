@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsDirtyIgnoresCursorMoves(t *testing.T) {
+	editor := NewTextEditor()
+	editor.SetContent("Hello")
+	invoker := NewCommandInvoker()
+	invoker.MarkSaved()
+
+	steps := []struct {
+		name  string
+		run   func() error
+		dirty bool
+	}{
+		{"move cursor", func() error { return invoker.ExecuteCommand(NewMoveCursorCommand(editor, 2)) }, false},
+		{"select", func() error { return invoker.ExecuteCommand(NewSelectCommand(editor, 0, 5)) }, false},
+		{"write", func() error { return invoker.ExecuteCommand(NewWriteCommand(editor, "!")) }, true},
+		{"move after write", func() error { return invoker.ExecuteCommand(NewMoveCursorCommand(editor, 0)) }, true},
+		{"undo move", invoker.UndoLastCommand, true},
+		{"undo write", invoker.UndoLastCommand, false},
+		{"undo select", invoker.UndoLastCommand, false},
+		{"macro of moves", func() error {
+			macro := NewMacroCommand("moves")
+			macro.AddCommand(NewMoveCursorCommand(editor, 1))
+			macro.AddCommand(NewSelectCommand(editor, 1, 3))
+			return invoker.ExecuteCommand(macro)
+		}, false},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := invoker.IsDirty(); got != step.dirty {
+			t.Errorf("after %s: IsDirty() = %v, want %v", step.name, got, step.dirty)
+		}
+	}
+}
+
+// ジャーナルを再生するときは、ファイルが変わっていても記録した時点に読み直した内容に戻す
+func TestRevertReplaysJournaledContent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "memo.txt")
+	journalPath := filepath.Join(dir, "editor.jsonl")
+	if err := os.WriteFile(path, []byte("\xEF\xBB\xBFfirst\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewCommandRegistry()
+	journal, err := OpenCommandJournal(journalPath, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	editor, err := OpenTextEditor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoker := NewCommandInvoker(WithJournal(journal))
+	invoker.ExecuteCommand(NewClearCommand(editor))
+	if err := invoker.ExecuteCommand(NewRevertCommand(editor)); err != nil {
+		t.Fatalf("revert: %v", err)
+	}
+	journal.Close()
+
+	if err := os.WriteFile(path, []byte("second\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := OpenTextEditor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := ReplayCommandJournal(f, replayed, NewCommandInvoker(), registry); err != nil {
+		t.Fatalf("ReplayCommandJournal: %v", err)
+	}
+	if got, want := replayed.GetContent(), "first\n"; got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+	if !replayed.file.bom || !replayed.file.crlf {
+		t.Errorf("file = %+v, want BOM and CRLF from the journaled revert", replayed.file)
+	}
+}
+
+// 取り消すと、読み直す前の内容に加えて保存するときの改行コード・BOM も戻る
+func TestRevertUndoRestoresFileFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memo.txt")
+	if err := os.WriteFile(path, []byte("\xEF\xBB\xBFfirst\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	editor, err := OpenTextEditor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := editor.file
+	if err := os.WriteFile(path, []byte("second\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	invoker := NewCommandInvoker()
+	if err := invoker.ExecuteCommand(NewRevertCommand(editor)); err != nil {
+		t.Fatal(err)
+	}
+	if editor.file.bom || editor.file.crlf {
+		t.Errorf("file after revert = %+v, want no BOM and LF", editor.file)
+	}
+	if err := invoker.UndoLastCommand(); err != nil {
+		t.Fatal(err)
+	}
+	if editor.GetContent() != "first\n" || editor.file != before {
+		t.Errorf("after undo: content %q, file %+v, want %q, %+v", editor.GetContent(), editor.file, "first\n", before)
+	}
+	if err := editor.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "\xEF\xBB\xBFfirst\r\n" {
+		t.Errorf("saved after undo = %q, want the original BOM and CRLF", data)
+	}
+
+	if err := invoker.RedoLastCommand(); err != nil {
+		t.Fatal(err)
+	}
+	// やり直しはファイルを読み直さず、最初に読み直した内容と形式に戻す
+	if editor.GetContent() != "second\n" || editor.file.bom || editor.file.crlf {
+		t.Errorf("after redo: content %q, file %+v", editor.GetContent(), editor.file)
+	}
+}
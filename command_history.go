@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// HistoryEntry は取り消し・やり直しで行き来できる一本の履歴のうちの1件
+type HistoryEntry struct {
+	// Index は初期状態の次を 1 とする履歴上の位置
+	Index       int       `json:"index"`
+	NodeID      int       `json:"node_id"`
+	Description string    `json:"description"`
+	Timestamp   time.Time `json:"timestamp"`
+	Type        string    `json:"type"`
+	// Undone は取り消し済みで、RedoLastCommand でやり直せる状態かどうか
+	Undone bool `json:"undone"`
+}
+
+type HistoryFormat int
+
+const (
+	HistoryText HistoryFormat = iota
+	HistoryJSON
+	HistoryTable
+)
+
+func (f HistoryFormat) String() string {
+	switch f {
+	case HistoryText:
+		return "text"
+	case HistoryJSON:
+		return "json"
+	case HistoryTable:
+		return "table"
+	default:
+		return "unknown"
+	}
+}
+
+// History は初期状態から現在位置までの適用済みのコマンドに続けて、
+// RedoLastCommand で順にやり直せる取り消し済みのコマンドを返す
+func (ci *CommandInvoker) History() []HistoryEntry {
+	entries := make([]HistoryEntry, 0)
+	add := func(node *undoNode, undone bool) {
+		entries = append(entries, HistoryEntry{
+			Index:       len(entries) + 1,
+			NodeID:      node.id,
+			Description: node.command.GetDescription(),
+			Timestamp:   node.executedAt,
+			Type:        commandTypeName(node.command),
+			Undone:      undone,
+		})
+	}
+	for _, node := range ci.current.path() {
+		add(node, false)
+	}
+	for node := ci.current.redo; node != nil; node = node.redo {
+		add(node, true)
+	}
+	return entries
+}
+
+// TypedCommand は履歴に表示する種類名を持つコマンド。ジャーナルに記録できるコマンドは必ず実装する。
+type TypedCommand interface {
+	Command
+	CommandType() string
+}
+
+// customCommandType は種類名を持たないコマンドの履歴上の種類名
+const customCommandType = "custom"
+
+// commandTypeName は command の種類名を返す。TypedCommand でなければ customCommandType を返す。
+func commandTypeName(command Command) string {
+	if typed, ok := command.(TypedCommand); ok {
+		return typed.CommandType()
+	}
+	return customCommandType
+}
+
+// RenderHistory は entries を format で w に書き出す
+func RenderHistory(w io.Writer, entries []HistoryEntry, format HistoryFormat) error {
+	switch format {
+	case HistoryText:
+		return renderHistoryText(w, entries)
+	case HistoryJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(entries)
+	case HistoryTable:
+		return renderHistoryTable(w, entries)
+	default:
+		return fmt.Errorf("unknown history format %d", format)
+	}
+}
+
+func renderHistoryText(w io.Writer, entries []HistoryEntry) error {
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(w, "（履歴なし）")
+		return err
+	}
+	for _, entry := range entries {
+		suffix := ""
+		if entry.Undone {
+			suffix = " （取り消し済み）"
+		}
+		if _, err := fmt.Fprintf(w, "%d. %s%s\n", entry.Index, entry.Description, suffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderHistoryTable(w io.Writer, entries []HistoryEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tTYPE\tTIME\tSTATE\tDESCRIPTION")
+	for _, entry := range entries {
+		state := "applied"
+		if entry.Undone {
+			state = "undone"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n",
+			entry.Index, entry.Type, entry.Timestamp.Format(time.TimeOnly), state, entry.Description)
+	}
+	return tw.Flush()
+}
+
+func ExecCommandHistory() {
+	fmt.Println("=== Command History Demo ===")
+
+	clock := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithClock(func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}))
+
+	invoker.ExecuteCommand(NewWriteCommand(editor, "Hello World"))
+	invoker.ExecuteCommand(NewReplaceCommand(editor, "World", "Go"))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "!"))
+	invoker.UndoLastCommand()
+	editor.Print()
+
+	for _, format := range []HistoryFormat{HistoryText, HistoryTable, HistoryJSON} {
+		fmt.Printf("\n--- %s ---\n", format)
+		if err := RenderHistory(os.Stdout, invoker.History(), format); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+		}
+	}
+
+	fmt.Println("\n=== Demo completed ===")
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// historyEntryOverhead は履歴1件ごとに、差分の文字列以外にかかるおおよそのバイト数
+const historyEntryOverhead = 64
+
+// HistoryStats は履歴の使用量と上限。上限が 0 の項目は無制限を表す。
+type HistoryStats struct {
+	Entries    int
+	Bytes      int
+	MaxEntries int
+	MaxBytes   int
+	// Evicted は上限を超えたために捨てた履歴の件数の累計
+	Evicted int
+}
+
+// historyBudget は TextEditor と CommandInvoker で共通の、件数とバイト数による履歴の上限
+type historyBudget struct {
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	evicted    int
+}
+
+func (b *historyBudget) exceeded(entries int) bool {
+	return (b.maxEntries > 0 && entries > b.maxEntries) ||
+		(b.maxBytes > 0 && b.bytes > b.maxBytes)
+}
+
+func (b *historyBudget) stats(entries int) HistoryStats {
+	return HistoryStats{
+		Entries:    entries,
+		Bytes:      b.bytes,
+		MaxEntries: b.maxEntries,
+		MaxBytes:   b.maxBytes,
+		Evicted:    b.evicted,
+	}
+}
+
+func (s HistoryStats) String() string {
+	limit := func(n int) string {
+		if n <= 0 {
+			return "無制限"
+		}
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%d/%s件, %d/%sバイト, 破棄 %d件",
+		s.Entries, limit(s.MaxEntries), s.Bytes, limit(s.MaxBytes), s.Evicted)
+}
+
+func editsSize(edits []textEdit) int {
+	size := 0
+	for _, edit := range edits {
+		size += len(edit.removed) + len(edit.inserted)
+	}
+	return size
+}
+
+func historyEntrySize(edits []textEdit) int {
+	return historyEntryOverhead + editsSize(edits)
+}
+
+// WithEditorHistoryLimit は RestorePreviousContent で戻せる履歴を、
+// 最大 entries 件・おおよそ bytes バイトまでに制限する。0 は無制限。
+func WithEditorHistoryLimit(entries, bytes int) EditorOption {
+	return func(te *TextEditor) {
+		te.budget.maxEntries = entries
+		te.budget.maxBytes = bytes
+	}
+}
+
+// pushHistory は record を履歴に積み、上限を超えた分を古いものから捨てる
+func (te *TextEditor) pushHistory(record *editRecord) {
+	te.history = append(te.history, record)
+	te.budget.bytes += historyEntrySize(record.edits)
+	for len(te.history) > 0 && te.budget.exceeded(len(te.history)) {
+		te.budget.bytes -= historyEntrySize(te.history[0].edits)
+		te.release(te.history[0])
+		te.history[0] = nil
+		te.history = te.history[1:]
+		te.budget.evicted++
+	}
+}
+
+func (te *TextEditor) HistoryStats() HistoryStats {
+	return te.budget.stats(len(te.history))
+}
+
+// sizedCommand は履歴の上限判定に使うおおよそのバイト数を返せるコマンド
+type sizedCommand interface {
+	historySize() int
+}
+
+// commandSize は command のおおよそのバイト数を返す。大きさがわからないコマンドは説明の長さで見積もる。
+func commandSize(command Command) int {
+	if sized, ok := command.(sizedCommand); ok {
+		return sized.historySize()
+	}
+	return len(command.GetDescription())
+}
+
+func (wc *WriteCommand) historySize() int            { return wc.record.size() }
+func (dc *DeleteCommand) historySize() int           { return dc.record.size() }
+func (rc *ReplaceCommand) historySize() int          { return rc.record.size() }
+func (cc *ClearCommand) historySize() int            { return cc.record.size() }
+func (ic *InsertCommand) historySize() int           { return ic.record.size() }
+func (dc *DeleteRangeCommand) historySize() int      { return dc.record.size() }
+func (mc *MoveCursorCommand) historySize() int       { return 0 }
+func (rc *ReplaceSelectionCommand) historySize() int { return rc.record.size() }
+func (rc *PatternReplaceCommand) historySize() int   { return rc.record.size() }
+
+// releasableCommand は取り消しに備えてエディタの変更ログを参照しているコマンド。
+// 履歴から捨てるときに release を呼ぶと、エディタは参照されなくなったログを捨てられる。
+type releasableCommand interface {
+	release()
+}
+
+func releaseCommand(command Command) {
+	if releasable, ok := command.(releasableCommand); ok {
+		releasable.release()
+	}
+}
+
+func (wc *WriteCommand) release()            { wc.editor.release(wc.record) }
+func (dc *DeleteCommand) release()           { dc.editor.release(dc.record) }
+func (rc *ReplaceCommand) release()          { rc.editor.release(rc.record) }
+func (cc *ClearCommand) release()            { cc.editor.release(cc.record) }
+func (ic *InsertCommand) release()           { ic.editor.release(ic.record) }
+func (dc *DeleteRangeCommand) release()      { dc.editor.release(dc.record) }
+func (rc *ReplaceSelectionCommand) release() { rc.editor.release(rc.record) }
+func (rc *PatternReplaceCommand) release()   { rc.editor.release(rc.record) }
+
+func (mc *MacroCommand) release() {
+	for _, command := range mc.commands {
+		releaseCommand(command)
+	}
+}
+
+func (mc *MacroCommand) historySize() int {
+	size := 0
+	for _, command := range mc.commands {
+		size += commandSize(command)
+	}
+	return size
+}
+
+// WithHistoryLimit は取り消しツリーのノードを、初期状態を除いて最大 entries 件・
+// おおよそ bytes バイトまでに制限する。0 は無制限。
+// 上限を超えると最も古いノードから捨てる。現在位置へ至る経路上のノードなら、それが新しい初期状態になり
+// そこより前には取り消せなくなる。経路から外れた枝なら、その枝ごと捨てる。
+func WithHistoryLimit(entries, bytes int) InvokerOption {
+	return func(ci *CommandInvoker) {
+		ci.budget.maxEntries = entries
+		ci.budget.maxBytes = bytes
+	}
+}
+
+func (ci *CommandInvoker) HistoryStats() HistoryStats {
+	return ci.budget.stats(len(ci.nodes) - 1)
+}
+
+// resize は node の大きさを測り直し、上限を超えていれば古いノードを捨てる
+func (ci *CommandInvoker) resize(node *undoNode) {
+	size := historyEntryOverhead + commandSize(node.command)
+	ci.budget.bytes += size - node.size
+	node.size = size
+	ci.enforceHistoryLimit()
+}
+
+func (ci *CommandInvoker) enforceHistoryLimit() {
+	for len(ci.root.children) > 0 && ci.budget.exceeded(len(ci.nodes)-1) {
+		// ID は実行順に振るので、最も古いノードは必ずルートの子になる
+		oldest := ci.root.children[0]
+		for _, child := range ci.root.children[1:] {
+			if child.id < oldest.id {
+				oldest = child
+			}
+		}
+		if slices.Contains(ci.current.path(), oldest) {
+			ci.promoteRoot(oldest)
+		} else {
+			ci.removeSubtree(oldest)
+		}
+	}
+}
+
+// promoteRoot はルートの子 node を新しいルートにする。node 以外の枝は捨てる。
+func (ci *CommandInvoker) promoteRoot(node *undoNode) {
+	for _, child := range slices.Clone(ci.root.children) {
+		if child != node {
+			ci.removeSubtree(child)
+		}
+	}
+	delete(ci.nodes, ci.root.id)
+	ci.budget.bytes -= node.size
+	ci.budget.evicted++
+	releaseCommand(node.command)
+	node.command = nil
+	node.parent = nil
+	node.size = 0
+	ci.root = node
+}
+
+func (ci *CommandInvoker) removeSubtree(node *undoNode) {
+	parent := node.parent
+	parent.children = slices.DeleteFunc(parent.children, func(child *undoNode) bool { return child == node })
+	if parent.redo == node {
+		parent.redo = nil
+		if len(parent.children) > 0 {
+			parent.redo = parent.children[len(parent.children)-1]
+		}
+	}
+	var remove func(n *undoNode)
+	remove = func(n *undoNode) {
+		for _, child := range n.children {
+			remove(child)
+		}
+		releaseCommand(n.command)
+		delete(ci.nodes, n.id)
+		ci.budget.bytes -= n.size
+		ci.budget.evicted++
+	}
+	remove(node)
+}
+
+func ExecHistoryLimit() {
+	fmt.Println("=== History Limit Demo ===")
+
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(
+		WithMiddleware(LoggingMiddleware(os.Stdout)),
+		WithHistoryLimit(3, 1024),
+	)
+
+	for _, word := range []string{"one ", "two ", "three ", "four ", "five "} {
+		invoker.ExecuteCommand(NewWriteCommand(editor, word))
+	}
+	editor.Print()
+	invoker.ShowHistory()
+	fmt.Printf("コマンド履歴: %v\n", invoker.HistoryStats())
+
+	fmt.Println("\n--- 取り消せるのは残っている分だけ ---")
+	for invoker.CanUndo() {
+		invoker.UndoLastCommand()
+	}
+	editor.Print()
+
+	fmt.Println("\n--- バイト数の上限 ---")
+	small := NewCommandInvoker(WithHistoryLimit(0, 200))
+	for _, ch := range "abc" {
+		small.ExecuteCommand(NewWriteCommand(editor, strings.Repeat(string(ch), 40)))
+		fmt.Printf("コマンド履歴: %v\n", small.HistoryStats())
+	}
+	small.ShowUndoTree()
+
+	fmt.Println("\n--- エディタを直接編集した履歴の上限 ---")
+	direct := NewTextEditor(WithEditorHistoryLimit(3, 0))
+	for _, word := range []string{"one ", "two ", "three ", "four ", "five "} {
+		direct.AppendText(word)
+	}
+	fmt.Printf("エディタ履歴: %v\n", direct.HistoryStats())
+	for direct.HistoryStats().Entries > 0 {
+		direct.RestorePreviousContent()
+	}
+	direct.Print()
+
+	fmt.Println("\n=== Demo completed ===")
+}
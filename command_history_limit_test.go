@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+// コマンドの実行・取り消しはエディタの履歴に積まれないので、RestorePreviousContent と食い違わない
+func TestCommandsDoNotUseEditorHistory(t *testing.T) {
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker()
+	invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "b"))
+	invoker.UndoLastCommand()
+
+	editor.RestorePreviousContent()
+	if got := editor.GetContent(); got != "a" {
+		t.Fatalf("after RestorePreviousContent: content = %q, want %q", got, "a")
+	}
+	if !invoker.CanRedo() {
+		t.Fatal("CanRedo() = false, want true")
+	}
+	if err := invoker.RedoLastCommand(); err != nil {
+		t.Fatalf("RedoLastCommand: %v", err)
+	}
+	if got := editor.GetContent(); got != "ab" {
+		t.Errorf("after redo: content = %q, want %q", got, "ab")
+	}
+}
+
+func TestInvokerHistoryLimitBoundsEditorMemory(t *testing.T) {
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithHistoryLimit(3, 0))
+	for i := 0; i < 100; i++ {
+		invoker.ExecuteCommand(NewWriteCommand(editor, "x"))
+	}
+	if got := invoker.HistoryStats().Entries; got != 3 {
+		t.Errorf("invoker entries = %d, want 3", got)
+	}
+	if got := editor.HistoryStats().Entries; got != 0 {
+		t.Errorf("editor entries = %d, want 0", got)
+	}
+}
+
+func TestEditorHistoryLimit(t *testing.T) {
+	editor := NewTextEditor(WithEditorHistoryLimit(2, 0))
+	for _, text := range []string{"a", "b", "c"} {
+		editor.AppendText(text)
+	}
+	stats := editor.HistoryStats()
+	if stats.Entries != 2 || stats.Evicted != 1 {
+		t.Fatalf("stats = %+v, want 2 entries and 1 evicted", stats)
+	}
+	editor.RestorePreviousContent()
+	editor.RestorePreviousContent()
+	editor.RestorePreviousContent()
+	if got := editor.GetContent(); got != "a" {
+		t.Errorf("content = %q, want %q", got, "a")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// historyFixture は時刻を1秒ずつ進めながら3件実行し、最後の1件を取り消した履歴を返す
+func historyFixture(t *testing.T) []HistoryEntry {
+	t.Helper()
+	clock := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithClock(func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}))
+	for _, command := range []Command{
+		NewWriteCommand(editor, "Hello <World>"),
+		NewReplaceCommand(editor, "World", "Go"),
+		NewWriteCommand(editor, "!"),
+	} {
+		if err := invoker.ExecuteCommand(command); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := invoker.UndoLastCommand(); err != nil {
+		t.Fatal(err)
+	}
+	return invoker.History()
+}
+
+func TestRenderHistory(t *testing.T) {
+	tests := []struct {
+		format HistoryFormat
+		want   string
+	}{
+		{HistoryText, `1. Write: "Hello <World>"
+2. Replace: "World" -> "Go"
+3. Write: "!" （取り消し済み）
+`},
+		{HistoryTable, `#  TYPE     TIME      STATE    DESCRIPTION
+1  write    09:00:01  applied  Write: "Hello <World>"
+2  replace  09:00:02  applied  Replace: "World" -> "Go"
+3  write    09:00:03  undone   Write: "!"
+`},
+		// < や > はエスケープしない
+		{HistoryJSON, `[
+  {
+    "index": 1,
+    "node_id": 1,
+    "description": "Write: \"Hello <World>\"",
+    "timestamp": "2025-01-01T09:00:01Z",
+    "type": "write",
+    "undone": false
+  },
+  {
+    "index": 2,
+    "node_id": 2,
+    "description": "Replace: \"World\" -> \"Go\"",
+    "timestamp": "2025-01-01T09:00:02Z",
+    "type": "replace",
+    "undone": false
+  },
+  {
+    "index": 3,
+    "node_id": 3,
+    "description": "Write: \"!\"",
+    "timestamp": "2025-01-01T09:00:03Z",
+    "type": "write",
+    "undone": true
+  }
+]
+`},
+	}
+	entries := historyFixture(t)
+	for _, tt := range tests {
+		var sb strings.Builder
+		if err := RenderHistory(&sb, entries, tt.format); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if got := sb.String(); got != tt.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestRenderEmptyHistory(t *testing.T) {
+	tests := []struct {
+		format HistoryFormat
+		want   string
+	}{
+		{HistoryText, "（履歴なし）\n"},
+		{HistoryTable, "#  TYPE  TIME  STATE  DESCRIPTION\n"},
+		{HistoryJSON, "[]\n"},
+	}
+	for _, tt := range tests {
+		var sb strings.Builder
+		if err := RenderHistory(&sb, NewCommandInvoker().History(), tt.format); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if got := sb.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.format, got, tt.want)
+		}
+	}
+	if err := RenderHistory(&strings.Builder{}, nil, HistoryFormat(99)); err == nil {
+		t.Error("unknown format: want an error")
+	}
+}
+
+// untypedCommand は種類名を持たない、何もしないコマンド
+type untypedCommand struct{}
+
+func (untypedCommand) Execute() error         { return nil }
+func (untypedCommand) Undo() error            { return nil }
+func (untypedCommand) GetDescription() string { return "untyped" }
+
+func TestHistoryTypeName(t *testing.T) {
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker()
+	invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+	macro := NewMacroCommand("m")
+	macro.AddCommand(NewDeleteCommand(editor, 1))
+	invoker.ExecuteCommand(macro)
+	invoker.ExecuteCommand(untypedCommand{})
+
+	var got []string
+	for _, entry := range invoker.History() {
+		got = append(got, entry.Type)
+	}
+	if want := []string{"write", "macro", customCommandType}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("types = %v, want %v", got, want)
+	}
+}
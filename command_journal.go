@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SerializableCommand はジャーナルに記録できるコマンド
+type SerializableCommand interface {
+	TypedCommand
+	MarshalArgs(registry *CommandRegistry) (json.RawMessage, error)
+}
+
+type CommandRecord struct {
+	Type string          `json:"type"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type CommandDecoder func(editor *TextEditor, args json.RawMessage, registry *CommandRegistry) (Command, error)
+
+type CommandRegistry struct {
+	decoders map[string]CommandDecoder
+}
+
+// NewCommandRegistry は組み込みのコマンドを登録済みのレジストリを返す
+func NewCommandRegistry() *CommandRegistry {
+	registry := &CommandRegistry{
+		decoders: make(map[string]CommandDecoder),
+	}
+	registry.Register("write", decodeWriteCommand)
+	registry.Register("delete", decodeDeleteCommand)
+	registry.Register("replace", decodeReplaceCommand)
+	registry.Register("pattern_replace", decodePatternReplaceCommand)
+	registry.Register("clear", decodeClearCommand)
+	registry.Register("revert", decodeRevertCommand)
+	registry.Register("insert", decodeInsertCommand)
+	registry.Register("delete_range", decodeDeleteRangeCommand)
+	registry.Register("move_cursor", decodeMoveCursorCommand)
+	registry.Register("replace_selection", decodeReplaceSelectionCommand)
+	registry.Register("macro", decodeMacroCommand)
+	return registry
+}
+
+func (r *CommandRegistry) Register(typeName string, decoder CommandDecoder) {
+	r.decoders[typeName] = decoder
+}
+
+func (r *CommandRegistry) Encode(command Command) (CommandRecord, error) {
+	serializable, ok := command.(SerializableCommand)
+	if !ok {
+		return CommandRecord{}, fmt.Errorf("command %q is not serializable", command.GetDescription())
+	}
+	typeName := serializable.CommandType()
+	if _, ok := r.decoders[typeName]; !ok {
+		return CommandRecord{}, fmt.Errorf("command type %q is not registered", typeName)
+	}
+	args, err := serializable.MarshalArgs(r)
+	if err != nil {
+		return CommandRecord{}, fmt.Errorf("encode %s: %w", typeName, err)
+	}
+	return CommandRecord{Type: typeName, Args: args}, nil
+}
+
+func (r *CommandRegistry) Decode(editor *TextEditor, record CommandRecord) (Command, error) {
+	decoder, ok := r.decoders[record.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown command type %q", record.Type)
+	}
+	command, err := decoder(editor, record.Args, r)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", record.Type, err)
+	}
+	return command, nil
+}
+
+type writeArgs struct {
+	Text string `json:"text"`
+}
+
+func (wc *WriteCommand) CommandType() string {
+	return "write"
+}
+
+func (wc *WriteCommand) MarshalArgs(*CommandRegistry) (json.RawMessage, error) {
+	return json.Marshal(writeArgs{Text: wc.text})
+}
+
+func decodeWriteCommand(editor *TextEditor, raw json.RawMessage, _ *CommandRegistry) (Command, error) {
+	var args writeArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	return NewWriteCommand(editor, args.Text), nil
+}
+
+type deleteArgs struct {
+	Length int `json:"length"`
+}
+
+func (dc *DeleteCommand) CommandType() string {
+	return "delete"
+}
+
+func (dc *DeleteCommand) MarshalArgs(*CommandRegistry) (json.RawMessage, error) {
+	return json.Marshal(deleteArgs{Length: dc.length})
+}
+
+func decodeDeleteCommand(editor *TextEditor, raw json.RawMessage, _ *CommandRegistry) (Command, error) {
+	var args deleteArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	return NewDeleteCommand(editor, args.Length), nil
+}
+
+type replaceArgs struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+func (rc *ReplaceCommand) CommandType() string {
+	return "replace"
+}
+
+func (rc *ReplaceCommand) MarshalArgs(*CommandRegistry) (json.RawMessage, error) {
+	return json.Marshal(replaceArgs{Old: rc.old, New: rc.new})
+}
+
+func decodeReplaceCommand(editor *TextEditor, raw json.RawMessage, _ *CommandRegistry) (Command, error) {
+	var args replaceArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	return NewReplaceCommand(editor, args.Old, args.New), nil
+}
+
+type patternReplaceArgs struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Regexp      bool   `json:"regexp,omitempty"`
+	IgnoreCase  bool   `json:"ignore_case,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+	Range       []int  `json:"range,omitempty"`
+}
+
+func (rc *PatternReplaceCommand) CommandType() string {
+	return "pattern_replace"
+}
+
+func (rc *PatternReplaceCommand) MarshalArgs(*CommandRegistry) (json.RawMessage, error) {
+	args := patternReplaceArgs{
+		Pattern:     rc.pattern,
+		Replacement: rc.replacement,
+		Regexp:      rc.regexp,
+		IgnoreCase:  rc.ignoreCase,
+		Limit:       rc.limit,
+	}
+	if rc.scoped {
+		args.Range = []int{rc.start, rc.end}
+	}
+	return json.Marshal(args)
+}
+
+func decodePatternReplaceCommand(editor *TextEditor, raw json.RawMessage, _ *CommandRegistry) (Command, error) {
+	var args patternReplaceArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	options := []ReplaceOption{WithReplaceLimit(args.Limit)}
+	if args.Regexp {
+		options = append(options, WithRegexp())
+	}
+	if args.IgnoreCase {
+		options = append(options, WithIgnoreCase())
+	}
+	if args.Range != nil {
+		if len(args.Range) != 2 {
+			return nil, fmt.Errorf("range must have 2 elements, got %d", len(args.Range))
+		}
+		options = append(options, WithReplaceRange(args.Range[0], args.Range[1]))
+	}
+	return NewPatternReplaceCommand(editor, args.Pattern, args.Replacement, options...), nil
+}
+
+func (cc *ClearCommand) CommandType() string {
+	return "clear"
+}
+
+func (cc *ClearCommand) MarshalArgs(*CommandRegistry) (json.RawMessage, error) {
+	return nil, nil
+}
+
+func decodeClearCommand(editor *TextEditor, _ json.RawMessage, _ *CommandRegistry) (Command, error) {
+	return NewClearCommand(editor), nil
+}
+
+func (rc *RevertCommand) CommandType() string {
+	return "revert"
+}
+
+// revertArgs は読み直した内容。再生したときにファイルが変わっていても、記録した時点と同じ内容に戻す。
+// まだ実行していない RevertCommand は引数なしで記録し、実行したときにファイルを読む。
+type revertArgs struct {
+	Content string `json:"content"`
+	BOM     bool   `json:"bom,omitempty"`
+	CRLF    bool   `json:"crlf,omitempty"`
+}
+
+func (rc *RevertCommand) MarshalArgs(*CommandRegistry) (json.RawMessage, error) {
+	if !rc.loaded {
+		return nil, nil
+	}
+	return json.Marshal(revertArgs{Content: rc.content, BOM: rc.file.bom, CRLF: rc.file.crlf})
+}
+
+func decodeRevertCommand(editor *TextEditor, raw json.RawMessage, _ *CommandRegistry) (Command, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return NewRevertCommand(editor), nil
+	}
+	var args revertArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	return &RevertCommand{
+		editor:  editor,
+		loaded:  true,
+		content: args.Content,
+		file:    editorFile{path: editor.file.path, bom: args.BOM, crlf: args.CRLF},
+	}, nil
+}
+
+type insertArgs struct {
+	Pos  int    `json:"pos"`
+	Text string `json:"text"`
+}
+
+func (ic *InsertCommand) CommandType() string {
+	return "insert"
+}
+
+func (ic *InsertCommand) MarshalArgs(*CommandRegistry) (json.RawMessage, error) {
+	return json.Marshal(insertArgs{Pos: ic.pos, Text: ic.text})
+}
+
+func decodeInsertCommand(editor *TextEditor, raw json.RawMessage, _ *CommandRegistry) (Command, error) {
+	var args insertArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	return NewInsertCommand(editor, args.Pos, args.Text), nil
+}
+
+type rangeArgs struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+func (dc *DeleteRangeCommand) CommandType() string {
+	return "delete_range"
+}
+
+func (dc *DeleteRangeCommand) MarshalArgs(*CommandRegistry) (json.RawMessage, error) {
+	return json.Marshal(rangeArgs{Start: dc.start, End: dc.end})
+}
+
+func decodeDeleteRangeCommand(editor *TextEditor, raw json.RawMessage, _ *CommandRegistry) (Command, error) {
+	var args rangeArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	return NewDeleteRangeCommand(editor, args.Start, args.End), nil
+}
+
+func (mc *MoveCursorCommand) CommandType() string {
+	return "move_cursor"
+}
+
+func (mc *MoveCursorCommand) MarshalArgs(*CommandRegistry) (json.RawMessage, error) {
+	return json.Marshal(rangeArgs{Start: mc.anchor, End: mc.cursor})
+}
+
+func decodeMoveCursorCommand(editor *TextEditor, raw json.RawMessage, _ *CommandRegistry) (Command, error) {
+	var args rangeArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	return NewSelectCommand(editor, args.Start, args.End), nil
+}
+
+func (rc *ReplaceSelectionCommand) CommandType() string {
+	return "replace_selection"
+}
+
+func (rc *ReplaceSelectionCommand) MarshalArgs(*CommandRegistry) (json.RawMessage, error) {
+	return json.Marshal(writeArgs{Text: rc.text})
+}
+
+func decodeReplaceSelectionCommand(editor *TextEditor, raw json.RawMessage, _ *CommandRegistry) (Command, error) {
+	var args writeArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	return NewReplaceSelectionCommand(editor, args.Text), nil
+}
+
+type macroArgs struct {
+	Description string          `json:"description"`
+	Commands    []CommandRecord `json:"commands"`
+}
+
+func (mc *MacroCommand) CommandType() string {
+	return "macro"
+}
+
+func (mc *MacroCommand) MarshalArgs(registry *CommandRegistry) (json.RawMessage, error) {
+	args := macroArgs{
+		Description: mc.description,
+		Commands:    make([]CommandRecord, 0, len(mc.commands)),
+	}
+	for _, command := range mc.commands {
+		record, err := registry.Encode(command)
+		if err != nil {
+			return nil, err
+		}
+		args.Commands = append(args.Commands, record)
+	}
+	return json.Marshal(args)
+}
+
+func decodeMacroCommand(editor *TextEditor, raw json.RawMessage, registry *CommandRegistry) (Command, error) {
+	var args macroArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	macro := NewMacroCommand(args.Description)
+	for _, record := range args.Commands {
+		command, err := registry.Decode(editor, record)
+		if err != nil {
+			return nil, err
+		}
+		macro.AddCommand(command)
+	}
+	return macro, nil
+}
+
+type JournalOp string
+
+const (
+	JournalExecute JournalOp = "execute"
+	// JournalMerge は直前の履歴に結合された実行
+	JournalMerge  JournalOp = "merge"
+	JournalUndo   JournalOp = "undo"
+	JournalRedo   JournalOp = "redo"
+	JournalJump   JournalOp = "jump"
+	JournalSelect JournalOp = "select"
+)
+
+var ErrJournalTruncated = errors.New("journal: last record is truncated")
+
+type journalEntry struct {
+	Op      JournalOp      `json:"op"`
+	Command *CommandRecord `json:"command,omitempty"`
+	Node    int            `json:"node,omitempty"`
+}
+
+// CommandJournal は CommandInvoker の操作を JSON Lines 形式でファイルに追記する。
+// 記録するのは invoker を通した操作だけで、AppendText や SetContent などで TextEditor を直接編集した内容は残らない。
+// 再生して同じ内容に戻したいなら、すべての編集をコマンドとして invoker で実行すること。
+type CommandJournal struct {
+	file     *os.File
+	registry *CommandRegistry
+}
+
+// OpenCommandJournal は path のジャーナルを追記用に開く。
+// 書き込み途中で途切れた末尾のレコードがあれば切り捨てる。
+func OpenCommandJournal(path string, registry *CommandRegistry) (*CommandJournal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	complete := int64(bytes.LastIndexByte(data, '\n') + 1)
+	if complete < int64(len(data)) {
+		if err := file.Truncate(complete); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if _, err := file.Seek(complete, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &CommandJournal{file: file, registry: registry}, nil
+}
+
+// Append は1操作を1行として書き込み、ディスクに同期する。nil の journal では何もしない。
+func (j *CommandJournal) Append(op JournalOp, command Command) error {
+	if j == nil {
+		return nil
+	}
+	entry := journalEntry{Op: op}
+	if command != nil {
+		record, err := j.registry.Encode(command)
+		if err != nil {
+			return err
+		}
+		entry.Command = &record
+	}
+	return j.write(entry)
+}
+
+// appendNode は取り消しツリーのノードを指定する操作（jump, select）を書き込む
+func (j *CommandJournal) appendNode(op JournalOp, node int) error {
+	if j == nil {
+		return nil
+	}
+	return j.write(journalEntry{Op: op, Node: node})
+}
+
+func (j *CommandJournal) write(entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *CommandJournal) Close() error {
+	return j.file.Close()
+}
+
+// ReplayCommandJournal は r のジャーナルを invoker 経由で editor に再適用し、適用したレコード数を返す。
+// 末尾のレコードが途切れていた場合は、それ以前をすべて適用したうえで ErrJournalTruncated を返す。
+// 位置や長さは editor の TextUnit で解釈されるため、記録時と同じ単位の editor を渡すこと。
+func ReplayCommandJournal(r io.Reader, editor *TextEditor, invoker *CommandInvoker, registry *CommandRegistry) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	// 再生中の操作をもう一度ジャーナルに書かないようにする
+	journal := invoker.journal
+	invoker.journal = nil
+	defer func() { invoker.journal = journal }()
+
+	lines := bytes.Split(data, []byte("\n"))
+	truncated := len(lines[len(lines)-1]) > 0
+	lines = lines[:len(lines)-1]
+
+	replayed := 0
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err := replayJournalEntry(line, editor, invoker, registry); err != nil {
+			return replayed, fmt.Errorf("journal line %d: %w", i+1, err)
+		}
+		replayed++
+	}
+	if truncated {
+		return replayed, ErrJournalTruncated
+	}
+	return replayed, nil
+}
+
+func replayJournalEntry(line []byte, editor *TextEditor, invoker *CommandInvoker, registry *CommandRegistry) error {
+	var entry journalEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return err
+	}
+	switch entry.Op {
+	case JournalExecute, JournalMerge:
+		if entry.Command == nil {
+			return fmt.Errorf("%s entry without command", entry.Op)
+		}
+		command, err := registry.Decode(editor, *entry.Command)
+		if err != nil {
+			return err
+		}
+		return invoker.execute(command, entry.Op == JournalMerge)
+	case JournalUndo:
+		return invoker.UndoLastCommand()
+	case JournalRedo:
+		return invoker.RedoLastCommand()
+	case JournalJump:
+		return invoker.JumpTo(entry.Node)
+	case JournalSelect:
+		return invoker.SelectRedoBranch(entry.Node)
+	default:
+		return fmt.Errorf("unknown journal op %q", entry.Op)
+	}
+}
+
+func ExecCommandJournal() {
+	fmt.Println("=== Command Journal Demo ===")
+
+	dir, err := os.MkdirTemp("", "command-journal")
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/editor.jsonl"
+
+	registry := NewCommandRegistry()
+	journal, err := OpenCommandJournal(path, registry)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(
+		WithJournal(journal),
+		WithMiddleware(LoggingMiddleware(os.Stdout)),
+	)
+
+	macro := NewMacroCommand("署名")
+	macro.AddCommand(NewWriteCommand(editor, "\n-- "))
+	macro.AddCommand(NewWriteCommand(editor, "Gopher"))
+
+	invoker.ExecuteCommand(NewWriteCommand(editor, "Hello World!"))
+	invoker.ExecuteCommand(NewReplaceCommand(editor, "World", "Go"))
+	invoker.ExecuteCommand(macro)
+	invoker.ExecuteCommand(NewDeleteCommand(editor, 6))
+	invoker.UndoLastCommand()
+	editor.Print()
+	journal.Close()
+
+	// 最後の書き込み中にプロセスが落ちた状況を再現する
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err == nil {
+		file.WriteString(`{"op":"execute","command":{"type":"wri`)
+		file.Close()
+	}
+
+	fmt.Println("\n--- ジャーナルから復元 ---")
+	file, err = os.Open(path)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	restored := NewTextEditor()
+	restoredInvoker := NewCommandInvoker()
+	replayed, err := ReplayCommandJournal(file, restored, restoredInvoker, registry)
+	if errors.Is(err, ErrJournalTruncated) {
+		fmt.Println("途切れた末尾のレコードを無視しました。")
+	} else if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+	fmt.Printf("復元したレコード数: %d\n", replayed)
+	restored.Print()
+	fmt.Printf("CanRedo: %v\n", restoredInvoker.CanRedo())
+
+	fmt.Println("\n=== Demo completed ===")
+}
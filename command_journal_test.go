@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recordJournal は run の操作をジャーナルに記録し、そのファイルのパスを返す
+func recordJournal(t *testing.T, run func(editor *TextEditor, invoker *CommandInvoker), options ...InvokerOption) (string, *TextEditor, *CommandInvoker) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "editor.jsonl")
+	journal, err := OpenCommandJournal(path, NewCommandRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(append(options, WithJournal(journal))...)
+	run(editor, invoker)
+	return path, editor, invoker
+}
+
+func replayJournal(t *testing.T, path string) (*TextEditor, *CommandInvoker, int, error) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	editor, invoker := NewTextEditor(), NewCommandInvoker()
+	n, err := ReplayCommandJournal(f, editor, invoker, NewCommandRegistry())
+	return editor, invoker, n, err
+}
+
+// treeShape は取り消しツリーの ID・親・説明・現在位置を比べられる形にする
+func treeShape(invoker *CommandInvoker) []UndoNodeInfo {
+	infos := invoker.UndoTree()
+	for i := range infos {
+		infos[i].ExecutedAt = time.Time{}
+	}
+	return infos
+}
+
+func assertSameReplay(t *testing.T, path string, editor *TextEditor, invoker *CommandInvoker) (*TextEditor, *CommandInvoker) {
+	t.Helper()
+	replayed, replayedInvoker, _, err := replayJournal(t, path)
+	if err != nil {
+		t.Fatalf("ReplayCommandJournal: %v", err)
+	}
+	if got, want := replayed.GetContent(), editor.GetContent(); got != want {
+		t.Errorf("replayed content = %q, want %q", got, want)
+	}
+	if got, want := treeShape(replayedInvoker), treeShape(invoker); !slices.EqualFunc(got, want, func(a, b UndoNodeInfo) bool {
+		return a.ID == b.ID && a.ParentID == b.ParentID && a.Description == b.Description &&
+			a.Current == b.Current && slices.Equal(a.Children, b.Children)
+	}) {
+		t.Errorf("replayed tree = %+v\nwant %+v", got, want)
+	}
+	return replayed, replayedInvoker
+}
+
+func TestJournalReplaysCoalescedCommands(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	path, editor, invoker := recordJournal(t, func(editor *TextEditor, invoker *CommandInvoker) {
+		for _, s := range []string{"H", "e", "l", "l", "o"} {
+			invoker.ExecuteCommand(NewWriteCommand(editor, s))
+		}
+		invoker.ExecuteCommand(NewDeleteCommand(editor, 1))
+		invoker.ExecuteCommand(NewDeleteCommand(editor, 1))
+		// 時間が空いたので別の履歴になる
+		now = now.Add(time.Minute)
+		invoker.ExecuteCommand(NewWriteCommand(editor, "p!"))
+	}, WithCoalescing(time.Second), WithClock(func() time.Time { return now }))
+	if got := len(invoker.UndoTree()); got != 4 {
+		t.Fatalf("%d nodes, want root, write, delete and the late write", got)
+	}
+
+	replayed, replayedInvoker := assertSameReplay(t, path, editor, invoker)
+	for _, want := range []string{"Hel", "Hello", ""} {
+		if err := replayedInvoker.UndoLastCommand(); err != nil {
+			t.Fatal(err)
+		}
+		if got := replayed.GetContent(); got != want {
+			t.Errorf("after undo: %q, want %q", got, want)
+		}
+	}
+}
+
+func TestJournalReplaysBranchJumps(t *testing.T) {
+	path, editor, invoker := recordJournal(t, func(editor *TextEditor, invoker *CommandInvoker) {
+		invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+		invoker.ExecuteCommand(NewWriteCommand(editor, "b"))
+		invoker.UndoLastCommand()
+		invoker.ExecuteCommand(NewWriteCommand(editor, "c"))
+		invoker.JumpTo(2)
+		invoker.UndoLastCommand()
+		invoker.SelectRedoBranch(3)
+	})
+	if got := editor.GetContent(); got != "a" {
+		t.Fatalf("content = %q, want %q", got, "a")
+	}
+
+	replayed, replayedInvoker := assertSameReplay(t, path, editor, invoker)
+	// 選んだ枝も再現されている
+	if err := replayedInvoker.RedoLastCommand(); err != nil {
+		t.Fatal(err)
+	}
+	if got := replayed.GetContent(); got != "ac" {
+		t.Errorf("redo after replay: %q, want %q", got, "ac")
+	}
+}
+
+func TestJournalReplaysNestedMacros(t *testing.T) {
+	path, editor, invoker := recordJournal(t, func(editor *TextEditor, invoker *CommandInvoker) {
+		inner := NewMacroCommand("inner")
+		inner.AddCommand(NewWriteCommand(editor, "y"))
+		inner.AddCommand(NewReplaceCommand(editor, "x", "z"))
+		outer := NewMacroCommand("outer")
+		outer.AddCommand(NewWriteCommand(editor, "x"))
+		outer.AddCommand(inner)
+		invoker.ExecuteCommand(outer)
+	})
+	if got := editor.GetContent(); got != "zy" {
+		t.Fatalf("content = %q, want %q", got, "zy")
+	}
+
+	replayed, replayedInvoker := assertSameReplay(t, path, editor, invoker)
+	if err := replayedInvoker.UndoLastCommand(); err != nil {
+		t.Fatal(err)
+	}
+	if got := replayed.GetContent(); got != "" {
+		t.Errorf("after undoing the macro: %q", got)
+	}
+}
+
+// 書き込み途中で途切れた末尾の行は再生せずに報告し、開き直すと切り捨てる
+func TestJournalTruncatedLastLine(t *testing.T) {
+	path, _, _ := recordJournal(t, func(editor *TextEditor, invoker *CommandInvoker) {
+		invoker.ExecuteCommand(NewWriteCommand(editor, "kept"))
+		invoker.ExecuteCommand(NewWriteCommand(editor, "!"))
+	})
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"execute","command":{"type":"wri`)
+	f.Close()
+
+	replayed, _, n, err := replayJournal(t, path)
+	if !errors.Is(err, ErrJournalTruncated) {
+		t.Fatalf("error = %v, want ErrJournalTruncated", err)
+	}
+	if n != 2 || replayed.GetContent() != "kept!" {
+		t.Errorf("replayed %d records, content %q", n, replayed.GetContent())
+	}
+
+	journal, err := OpenCommandJournal(path, NewCommandRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	editor := NewTextEditor()
+	editor.SetContent("kept!")
+	NewCommandInvoker(WithJournal(journal)).ExecuteCommand(NewDeleteCommand(editor, 1))
+	journal.Close()
+	replayed, _, n, err = replayJournal(t, path)
+	if err != nil || n != 3 || replayed.GetContent() != "kept" {
+		t.Errorf("after reopening: %d records, content %q, error %v", n, replayed.GetContent(), err)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+type CommandOperation int
+
+const (
+	OperationExecute CommandOperation = iota
+	OperationUndo
+	OperationRedo
+)
+
+func (op CommandOperation) String() string {
+	switch op {
+	case OperationExecute:
+		return "execute"
+	case OperationUndo:
+		return "undo"
+	case OperationRedo:
+		return "redo"
+	default:
+		return "unknown"
+	}
+}
+
+// CommandHandler は CommandInvoker がコマンドを実行・取り消し・やり直しするときに呼ぶ処理
+type CommandHandler func(op CommandOperation, command Command) error
+
+// CommandMiddleware は CommandHandler を包んで前後に処理を差し込む
+type CommandMiddleware func(next CommandHandler) CommandHandler
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrReadOnly         = errors.New("editor is read-only")
+	ErrDryRun           = errors.New("dry run: command was not applied")
+)
+
+// WithMiddleware は middlewares を先に指定したものが外側になるように積む
+func WithMiddleware(middlewares ...CommandMiddleware) InvokerOption {
+	return func(ci *CommandInvoker) {
+		ci.middlewares = append(ci.middlewares, middlewares...)
+	}
+}
+
+func chainMiddlewares(handler CommandHandler, middlewares []CommandMiddleware) CommandHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+func runCommand(op CommandOperation, command Command) error {
+	if op == OperationUndo {
+		return command.Undo()
+	}
+	return command.Execute()
+}
+
+// LoggingMiddleware は操作の前にコマンドの説明を w に書き出す
+func LoggingMiddleware(w io.Writer) CommandMiddleware {
+	labels := map[CommandOperation]string{
+		OperationExecute: "実行",
+		OperationUndo:    "取り消し",
+		OperationRedo:    "やり直し",
+	}
+	return func(next CommandHandler) CommandHandler {
+		return func(op CommandOperation, command Command) error {
+			fmt.Fprintf(w, "%s: %s\n", labels[op], command.GetDescription())
+			return next(op, command)
+		}
+	}
+}
+
+// TimingMiddleware は操作にかかった時間を record に渡す
+func TimingMiddleware(record func(op CommandOperation, command Command, elapsed time.Duration)) CommandMiddleware {
+	return func(next CommandHandler) CommandHandler {
+		return func(op CommandOperation, command Command) error {
+			start := time.Now()
+			err := next(op, command)
+			record(op, command, time.Since(start))
+			return err
+		}
+	}
+}
+
+// PermissionMiddleware は allow が false を返した操作を ErrPermissionDenied で拒否する
+func PermissionMiddleware(allow func(op CommandOperation, command Command) bool) CommandMiddleware {
+	return func(next CommandHandler) CommandHandler {
+		return func(op CommandOperation, command Command) error {
+			if !allow(op, command) {
+				return fmt.Errorf("%w: %s %s", ErrPermissionDenied, op, command.GetDescription())
+			}
+			return next(op, command)
+		}
+	}
+}
+
+// DryRunResult はドライランで試したコマンドの結果
+type DryRunResult struct {
+	Operation   CommandOperation
+	Description string
+	// Before と After は試す前と後の内容。Err が nil でなければ After は Before と同じ。
+	Before string
+	After  string
+	Err    error
+}
+
+// DryRunMiddleware は実行・やり直しを editor の複製で試し、結果を report に渡す。
+// 本物の editor には適用せずに ErrDryRun を返すので、履歴にも残らない。
+// コマンドは registry で複製に対して作り直すので、registry に登録されたコマンドだけを試せる。
+// 取り消しは複製では再現できないため、試さずに ErrDryRun を返す。
+func DryRunMiddleware(editor *TextEditor, registry *CommandRegistry, report func(DryRunResult)) CommandMiddleware {
+	return func(next CommandHandler) CommandHandler {
+		return func(op CommandOperation, command Command) error {
+			if op != OperationUndo {
+				report(tryOnCopy(editor, registry, op, command))
+			}
+			return fmt.Errorf("%w: %s %s", ErrDryRun, op, command.GetDescription())
+		}
+	}
+}
+
+func tryOnCopy(editor *TextEditor, registry *CommandRegistry, op CommandOperation, command Command) DryRunResult {
+	scratch := editor.scratchCopy()
+	result := DryRunResult{Operation: op, Description: command.GetDescription(), Before: scratch.GetContent()}
+	result.After = result.Before
+	record, err := registry.Encode(command)
+	if err == nil {
+		command, err = registry.Decode(scratch, record)
+	}
+	if err == nil {
+		err = command.Execute()
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.After = scratch.GetContent()
+	return result
+}
+
+// scratchCopy は内容・カーソル・単位・ファイルが te と同じで、履歴を持たないエディタを返す
+func (te *TextEditor) scratchCopy() *TextEditor {
+	scratch := NewTextEditor(WithTextUnit(te.unit))
+	scratch.text = newPieceTable(te.text.String())
+	scratch.setCursorState(te.cursorState())
+	scratch.file = te.file
+	return scratch
+}
+
+// ReadOnlyMiddleware は readOnly が true の間、すべての操作を ErrReadOnly で拒否する
+func ReadOnlyMiddleware(readOnly func() bool) CommandMiddleware {
+	return func(next CommandHandler) CommandHandler {
+		return func(op CommandOperation, command Command) error {
+			if readOnly() {
+				return fmt.Errorf("%w: %s %s", ErrReadOnly, op, command.GetDescription())
+			}
+			return next(op, command)
+		}
+	}
+}
+
+func ExecCommandMiddleware() {
+	fmt.Println("=== Command Middleware Demo ===")
+
+	readOnly := false
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithMiddleware(
+		LoggingMiddleware(os.Stdout),
+		TimingMiddleware(func(op CommandOperation, command Command, elapsed time.Duration) {
+			fmt.Printf("  (%s: %v)\n", op, elapsed.Round(time.Microsecond))
+		}),
+		PermissionMiddleware(func(op CommandOperation, command Command) bool {
+			_, isClear := command.(*ClearCommand)
+			return !isClear
+		}),
+		ReadOnlyMiddleware(func() bool { return readOnly }),
+	))
+
+	invoker.ExecuteCommand(NewWriteCommand(editor, "Hello World!"))
+	editor.Print()
+
+	fmt.Println("\n--- 権限チェック ---")
+	if err := invoker.ExecuteCommand(NewClearCommand(editor)); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+	editor.Print()
+
+	fmt.Println("\n--- 読み取り専用モード ---")
+	readOnly = true
+	if err := invoker.UndoLastCommand(); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+	readOnly = false
+	editor.Print()
+
+	fmt.Println("\n--- ドライラン ---")
+	dryRun := NewCommandInvoker(WithMiddleware(
+		LoggingMiddleware(os.Stdout),
+		DryRunMiddleware(editor, NewCommandRegistry(), func(result DryRunResult) {
+			if result.Err != nil {
+				fmt.Printf("  試した結果: エラー %v\n", result.Err)
+				return
+			}
+			fmt.Printf("  試した結果: \"%s\" -> \"%s\"\n", result.Before, result.After)
+		}),
+	))
+	if err := dryRun.ExecuteCommand(NewReplaceCommand(editor, "World", "Go")); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+	if err := dryRun.ExecuteCommand(NewDeleteRangeCommand(editor, 5, 99)); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+	editor.Print()
+
+	fmt.Println("\n=== Demo completed ===")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// traceMiddleware は呼ばれた順を trace に書き出す
+func traceMiddleware(name string, trace *[]string) CommandMiddleware {
+	return func(next CommandHandler) CommandHandler {
+		return func(op CommandOperation, command Command) error {
+			*trace = append(*trace, fmt.Sprintf("%s before %s", name, op))
+			err := next(op, command)
+			*trace = append(*trace, fmt.Sprintf("%s after %s", name, op))
+			return err
+		}
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var trace []string
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(
+		WithMiddleware(traceMiddleware("outer", &trace)),
+		WithMiddleware(traceMiddleware("inner", &trace)),
+	)
+	invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+	invoker.UndoLastCommand()
+	invoker.RedoLastCommand()
+
+	var want []string
+	for _, op := range []string{"execute", "undo", "redo"} {
+		want = append(want, "outer before "+op, "inner before "+op, "inner after "+op, "outer after "+op)
+	}
+	if !slices.Equal(trace, want) {
+		t.Errorf("trace = %q\nwant %q", trace, want)
+	}
+}
+
+func TestPermissionShortCircuits(t *testing.T) {
+	var trace []string
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithMiddleware(
+		PermissionMiddleware(func(op CommandOperation, command Command) bool {
+			_, isClear := command.(*ClearCommand)
+			return !isClear
+		}),
+		traceMiddleware("inner", &trace),
+	))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "keep"))
+	trace = nil
+
+	err := invoker.ExecuteCommand(NewClearCommand(editor))
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("error = %v, want ErrPermissionDenied", err)
+	}
+	if len(trace) != 0 {
+		t.Errorf("inner middleware ran: %q", trace)
+	}
+	if got := editor.GetContent(); got != "keep" {
+		t.Errorf("content = %q", got)
+	}
+	if got := len(invoker.UndoTree()); got != 2 {
+		t.Errorf("%d nodes, want the denied command left out of the history", got)
+	}
+}
+
+// 取り消し・やり直しを拒否しても、内容も履歴の位置も変わらない
+func TestMiddlewareRejectsUndoAndRedo(t *testing.T) {
+	readOnly := false
+	denyUndo := false
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithMiddleware(
+		ReadOnlyMiddleware(func() bool { return readOnly }),
+		PermissionMiddleware(func(op CommandOperation, command Command) bool {
+			return !denyUndo || op != OperationUndo
+		}),
+	))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "b"))
+	invoker.UndoLastCommand()
+
+	steps := []struct {
+		name               string
+		readOnly, denyUndo bool
+		run                func() error
+		want               error
+	}{
+		{"read-only undo", true, false, invoker.UndoLastCommand, ErrReadOnly},
+		{"read-only redo", true, false, invoker.RedoLastCommand, ErrReadOnly},
+		{"read-only execute", true, false, func() error { return invoker.ExecuteCommand(NewWriteCommand(editor, "c")) }, ErrReadOnly},
+		{"denied undo", false, true, invoker.UndoLastCommand, ErrPermissionDenied},
+	}
+	for _, step := range steps {
+		readOnly, denyUndo = step.readOnly, step.denyUndo
+		if err := step.run(); !errors.Is(err, step.want) {
+			t.Errorf("%s: error = %v, want %v", step.name, err, step.want)
+		}
+		if got := editor.GetContent(); got != "a" || invoker.CurrentNode() != 1 {
+			t.Errorf("%s: content %q at node %d, want %q at node 1", step.name, got, invoker.CurrentNode(), "a")
+		}
+	}
+
+	denyUndo = false
+	if err := invoker.RedoLastCommand(); err != nil || editor.GetContent() != "ab" {
+		t.Errorf("redo after lifting the restrictions: %q, %v", editor.GetContent(), err)
+	}
+}
+
+func TestDryRunTriesCommandOnCopy(t *testing.T) {
+	editor := NewTextEditor()
+	editor.SetContent("Hello World")
+	var results []DryRunResult
+	invoker := NewCommandInvoker(WithMiddleware(DryRunMiddleware(editor, NewCommandRegistry(), func(result DryRunResult) {
+		results = append(results, result)
+	})))
+
+	if err := invoker.ExecuteCommand(NewReplaceCommand(editor, "World", "Go")); !errors.Is(err, ErrDryRun) {
+		t.Errorf("error = %v, want ErrDryRun", err)
+	}
+	if err := invoker.ExecuteCommand(NewDeleteRangeCommand(editor, 3, 20)); !errors.Is(err, ErrDryRun) {
+		t.Errorf("error = %v, want ErrDryRun", err)
+	}
+	if got := editor.GetContent(); got != "Hello World" || invoker.CanUndo() {
+		t.Errorf("dry run changed the editor: %q, undoable %v", got, invoker.CanUndo())
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("%d results, want 2", len(results))
+	}
+	if r := results[0]; r.Err != nil || r.Before != "Hello World" || r.After != "Hello Go" || r.Operation != OperationExecute {
+		t.Errorf("replace: %+v", r)
+	}
+	if r := results[1]; !errors.Is(r.Err, ErrOutOfRange) || r.After != r.Before {
+		t.Errorf("out of range delete: %+v", r)
+	}
+}
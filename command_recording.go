@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrAlreadyRecording = errors.New("invoker is already recording")
+	ErrNotRecording     = errors.New("invoker is not recording")
+)
+
+type recordedCommand struct {
+	record CommandRecord
+	// node はこのコマンドを積んだ（または結合した）ノード。取り消したときに記録から外すのに使う。
+	node *undoNode
+}
+
+// commandRecording は記録中のマクロ。nil のときは何もしない。
+type commandRecording struct {
+	name     string
+	registry *CommandRegistry
+	commands []recordedCommand
+	// redoable は記録中に取り消したコマンド。やり直したら記録に戻す。
+	redoable [][]recordedCommand
+	err      error
+}
+
+// capture は実行した command を記録する。記録できないコマンドがあれば、StopRecording でエラーを返す。
+func (r *commandRecording) capture(command Command, node *undoNode) {
+	if r == nil {
+		return
+	}
+	record, err := r.registry.Encode(command)
+	if err != nil {
+		r.err = errors.Join(r.err, err)
+		return
+	}
+	r.commands = append(r.commands, recordedCommand{record: record, node: node})
+	r.redoable = nil
+}
+
+func (r *commandRecording) undone(node *undoNode) {
+	if r == nil {
+		return
+	}
+	i := len(r.commands)
+	for i > 0 && r.commands[i-1].node == node {
+		i--
+	}
+	if i == len(r.commands) {
+		return
+	}
+	r.redoable = append(r.redoable, r.commands[i:])
+	r.commands = r.commands[:i:i]
+}
+
+func (r *commandRecording) redone(node *undoNode) {
+	if r == nil || len(r.redoable) == 0 {
+		return
+	}
+	last := r.redoable[len(r.redoable)-1]
+	if last[0].node != node {
+		// 記録を始める前のコマンドや別の枝をやり直した場合は、記録の続きとして扱わない
+		r.redoable = nil
+		return
+	}
+	r.redoable = r.redoable[:len(r.redoable)-1]
+	r.commands = append(r.commands, last...)
+}
+
+// RecordedMacro は記録した一連のコマンド。エディタに依存しない形で持つので、別のエディタにも適用できる。
+type RecordedMacro struct {
+	Name     string          `json:"name"`
+	Commands []CommandRecord `json:"commands"`
+}
+
+// StartRecording は以降に実行したコマンドを registry で記録し始める。
+// 記録中に取り消したコマンドは記録から外れ、やり直すと元に戻る。
+func (ci *CommandInvoker) StartRecording(name string, registry *CommandRegistry) error {
+	if ci.recording != nil {
+		return fmt.Errorf("%w: %q", ErrAlreadyRecording, ci.recording.name)
+	}
+	ci.recording = &commandRecording{name: name, registry: registry}
+	return nil
+}
+
+// StopRecording は記録を終え、記録したコマンドを返す
+func (ci *CommandInvoker) StopRecording() (*RecordedMacro, error) {
+	if ci.recording == nil {
+		return nil, ErrNotRecording
+	}
+	recording := ci.recording
+	ci.recording = nil
+	if recording.err != nil {
+		return nil, fmt.Errorf("recording %q: %w", recording.name, recording.err)
+	}
+	macro := &RecordedMacro{Name: recording.name, Commands: make([]CommandRecord, 0, len(recording.commands))}
+	for _, command := range recording.commands {
+		macro.Commands = append(macro.Commands, command.record)
+	}
+	return macro, nil
+}
+
+func (ci *CommandInvoker) Recording() bool {
+	return ci.recording != nil
+}
+
+// Build は editor に対して記録したコマンドを順に実行する MacroCommand を作る
+func (m *RecordedMacro) Build(editor *TextEditor, registry *CommandRegistry) (*MacroCommand, error) {
+	macro := NewMacroCommand(m.Name)
+	for i, record := range m.Commands {
+		command, err := registry.Decode(editor, record)
+		if err != nil {
+			return nil, fmt.Errorf("macro %q command %d: %w", m.Name, i+1, err)
+		}
+		macro.AddCommand(command)
+	}
+	return macro, nil
+}
+
+// Save は path に JSON として書き出す
+func (m *RecordedMacro) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+func LoadRecordedMacro(path string) (*RecordedMacro, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var macro RecordedMacro
+	if err := json.Unmarshal(data, &macro); err != nil {
+		return nil, fmt.Errorf("load macro %s: %w", path, err)
+	}
+	return &macro, nil
+}
+
+func ExecMacroRecording() {
+	fmt.Println("=== Macro Recording Demo ===")
+
+	registry := NewCommandRegistry()
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithMiddleware(LoggingMiddleware(os.Stdout)))
+
+	invoker.ExecuteCommand(NewWriteCommand(editor, "Hello World"))
+
+	fmt.Println("\n--- 記録開始 ---")
+	invoker.StartRecording("sign", registry)
+	invoker.ExecuteCommand(NewReplaceCommand(editor, "World", "Go"))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "?"))
+	invoker.UndoLastCommand()
+	invoker.ExecuteCommand(NewWriteCommand(editor, "\n-- Gopher"))
+	macro, err := invoker.StopRecording()
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+	editor.Print()
+	for i, record := range macro.Commands {
+		fmt.Printf("%d. %s %s\n", i+1, record.Type, record.Args)
+	}
+
+	fmt.Println("\n--- 保存して読み込み、別のエディタに適用 ---")
+	dir, err := os.MkdirTemp("", "macro")
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sign.json")
+	if err := macro.Save(path); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+	loaded, err := LoadRecordedMacro(path)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+
+	other := NewTextEditor()
+	otherInvoker := NewCommandInvoker(WithMiddleware(LoggingMiddleware(os.Stdout)))
+	otherInvoker.ExecuteCommand(NewWriteCommand(other, "Goodbye World"))
+	command, err := loaded.Build(other, registry)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+	otherInvoker.ExecuteCommand(command)
+	other.Print()
+
+	fmt.Println("\n--- マクロはまとめて取り消せる ---")
+	otherInvoker.UndoLastCommand()
+	other.Print()
+
+	fmt.Println("\n=== Demo completed ===")
+}
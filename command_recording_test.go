@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func recordedTypes(macro *RecordedMacro) []string {
+	types := make([]string, 0, len(macro.Commands))
+	for _, record := range macro.Commands {
+		types = append(types, record.Type)
+	}
+	return types
+}
+
+func TestRecordingStartStop(t *testing.T) {
+	registry := NewCommandRegistry()
+	invoker := NewCommandInvoker()
+	if _, err := invoker.StopRecording(); !errors.Is(err, ErrNotRecording) {
+		t.Errorf("StopRecording before start: error = %v, want ErrNotRecording", err)
+	}
+	if err := invoker.StartRecording("m", registry); err != nil {
+		t.Fatal(err)
+	}
+	if err := invoker.StartRecording("n", registry); !errors.Is(err, ErrAlreadyRecording) {
+		t.Errorf("StartRecording twice: error = %v, want ErrAlreadyRecording", err)
+	}
+	if !invoker.Recording() {
+		t.Error("Recording() = false while recording")
+	}
+	macro, err := invoker.StopRecording()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if macro.Name != "m" || len(macro.Commands) != 0 {
+		t.Errorf("macro = %+v, want an empty macro m", macro)
+	}
+	if invoker.Recording() {
+		t.Error("Recording() = true after StopRecording")
+	}
+}
+
+func TestRecordingUndoWhileRecording(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(invoker *CommandInvoker, editor *TextEditor)
+		want []string
+	}{
+		{"undone command is dropped", func(invoker *CommandInvoker, editor *TextEditor) {
+			invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+			invoker.ExecuteCommand(NewDeleteCommand(editor, 1))
+			invoker.UndoLastCommand()
+			invoker.ExecuteCommand(NewClearCommand(editor))
+		}, []string{"write", "clear"}},
+		{"redone command is kept", func(invoker *CommandInvoker, editor *TextEditor) {
+			invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+			invoker.ExecuteCommand(NewDeleteCommand(editor, 1))
+			invoker.UndoLastCommand()
+			invoker.UndoLastCommand()
+			invoker.RedoLastCommand()
+			invoker.RedoLastCommand()
+		}, []string{"write", "delete"}},
+		{"undo before the recording started", func(invoker *CommandInvoker, editor *TextEditor) {
+			invoker.UndoLastCommand()
+			invoker.RedoLastCommand()
+			invoker.ExecuteCommand(NewDeleteCommand(editor, 1))
+		}, []string{"delete"}},
+		{"redo of another branch is not recorded", func(invoker *CommandInvoker, editor *TextEditor) {
+			invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+			invoker.UndoLastCommand()
+			invoker.ExecuteCommand(NewWriteCommand(editor, "b"))
+			invoker.UndoLastCommand()
+			invoker.SelectRedoBranch(invoker.RedoBranches()[0].ID)
+			invoker.RedoLastCommand()
+		}, []string{}},
+		// 結合された入力は1回の取り消しでまとめて外れる
+		{"coalesced commands are undone together", func(invoker *CommandInvoker, editor *TextEditor) {
+			invoker.ExecuteCommand(NewClearCommand(editor))
+			invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+			invoker.ExecuteCommand(NewWriteCommand(editor, "b"))
+			invoker.UndoLastCommand()
+		}, []string{"clear"}},
+	}
+	for _, tt := range tests {
+		clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		editor := NewTextEditor()
+		invoker := NewCommandInvoker(WithCoalescing(time.Second), WithClock(func() time.Time { return clock }))
+		invoker.ExecuteCommand(NewWriteCommand(editor, "before "))
+		clock = clock.Add(time.Minute)
+		if err := invoker.StartRecording(tt.name, NewCommandRegistry()); err != nil {
+			t.Fatal(err)
+		}
+		tt.run(invoker, editor)
+		macro, err := invoker.StopRecording()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := recordedTypes(macro); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: recorded %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecordingUnserializableCommand(t *testing.T) {
+	invoker := NewCommandInvoker()
+	invoker.StartRecording("m", NewCommandRegistry())
+	if err := invoker.ExecuteCommand(untypedCommand{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invoker.StopRecording(); err == nil {
+		t.Error("StopRecording: want an error for a command that cannot be recorded")
+	}
+	if invoker.Recording() {
+		t.Error("still recording after a failed StopRecording")
+	}
+}
+
+func TestRecordedMacroSaveLoadBuild(t *testing.T) {
+	registry := NewCommandRegistry()
+	editor := NewTextEditor()
+	editor.SetContent("Hello World")
+	invoker := NewCommandInvoker()
+	invoker.StartRecording("sign", registry)
+	invoker.ExecuteCommand(NewReplaceCommand(editor, "World", "Go"))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "\n-- \"Gopher\""))
+	invoker.ExecuteCommand(NewPatternReplaceCommand(editor, "o", "0", WithReplaceLimit(1)))
+	macro, err := invoker.StopRecording()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := editor.GetContent()
+
+	path := filepath.Join(t.TempDir(), "sign.json")
+	if err := macro.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadRecordedMacro(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "sign" || !slices.Equal(recordedTypes(loaded), recordedTypes(macro)) {
+		t.Errorf("loaded %s %v, want sign %v", loaded.Name, recordedTypes(loaded), recordedTypes(macro))
+	}
+
+	other := NewTextEditor()
+	other.SetContent("Hello World")
+	command, err := loaded.Build(other, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherInvoker := NewCommandInvoker()
+	if err := otherInvoker.ExecuteCommand(command); err != nil {
+		t.Fatal(err)
+	}
+	if got := other.GetContent(); got != want {
+		t.Errorf("content after the loaded macro = %q, want %q", got, want)
+	}
+	// 読み込んだマクロは1件の履歴としてまとめて取り消せる
+	if err := otherInvoker.UndoLastCommand(); err != nil || other.GetContent() != "Hello World" {
+		t.Errorf("after undo: %q, %v", other.GetContent(), err)
+	}
+}
+
+func TestRecordedMacroLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadRecordedMacro(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: error = %v, want ErrNotExist", err)
+	}
+	broken := filepath.Join(dir, "broken.json")
+	os.WriteFile(broken, []byte(`{"name": "m", "commands": [`), 0o644)
+	if _, err := LoadRecordedMacro(broken); err == nil {
+		t.Error("broken JSON: want an error")
+	}
+
+	unknown := &RecordedMacro{Name: "m", Commands: []CommandRecord{{Type: "write", Args: []byte(`{"text":"a"}`)}, {Type: "teleport"}}}
+	if _, err := unknown.Build(NewTextEditor(), NewCommandRegistry()); err == nil {
+		t.Error("unknown command type: want an error")
+	}
+}
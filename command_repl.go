@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// REPL は1行ずつ読んだエディタスクリプトを実行し、そのたびにバッファの内容を表示する対話モード。
+// スクリプトの文に加えて、次の REPL 専用のコマンドが使える。
+//
+//	history          適用済み・取り消し済みの履歴を表示する
+//	show             バッファの内容を表示する
+//	record name      以降に実行したコマンドをマクロ name として記録し始める。記録中に取り消したコマンドは記録から外れる。
+//	stop             記録を終えてマクロを定義する
+//	play name        マクロを1つのコマンドとして実行する（name だけでもよい）
+//	macros           定義済みのマクロを表示する
+//	help             使い方を表示する
+//	quit / exit      終了する
+//
+// replKeywords は REPL 専用のコマンド。マクロに同じ名前を付けると呼び出せなくなるので予約する。
+var replKeywords = map[string]bool{
+	"history": true, "show": true, "record": true, "stop": true, "play": true,
+	"macros": true, "help": true, "quit": true, "exit": true,
+}
+
+type REPL struct {
+	editor   *TextEditor
+	invoker  *CommandInvoker
+	out      io.Writer
+	script   *Script
+	registry *CommandRegistry
+	// recording は記録中のマクロの名前。記録そのものは invoker が持つ。
+	recording string
+	line      int
+}
+
+func NewREPL(editor *TextEditor, invoker *CommandInvoker, out io.Writer) *REPL {
+	return &REPL{
+		editor:   editor,
+		invoker:  invoker,
+		out:      out,
+		script:   &Script{macros: make(map[string][]scriptStep), reserved: replKeywords},
+		registry: NewCommandRegistry(),
+	}
+}
+
+// Run は in を最後まで、または quit が入力されるまで読んで実行する。
+// 入力の誤りやコマンドの失敗は表示して続行し、読み込みに失敗したときだけエラーを返す。
+func (r *REPL) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(r.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			return scanner.Err()
+		}
+		r.line++
+		if quit := r.Eval(scanner.Text()); quit {
+			return nil
+		}
+	}
+}
+
+// Eval は1行を実行する。終了するコマンドなら true を返す。
+func (r *REPL) Eval(line string) (quit bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "quit", "exit":
+		if r.recording != "" {
+			r.invoker.StopRecording()
+			fmt.Fprintf(r.out, "マクロ %q の記録を破棄しました\n", r.recording)
+		}
+		return true
+	case "help":
+		fmt.Fprintln(r.out, `write "text" / delete N / replace "old" "new" / clear / undo / redo`)
+		fmt.Fprintln(r.out, `macro name { ... } / record name / stop / play name / macros / history / show / quit`)
+	case "show":
+		r.show()
+	case "history":
+		if err := RenderHistory(r.out, r.invoker.History(), HistoryText); err != nil {
+			r.fail(err)
+		}
+	case "macros":
+		for _, name := range r.script.Macros() {
+			fmt.Fprintf(r.out, "%s (%d commands)\n", name, len(r.script.macros[name]))
+		}
+	case "record":
+		r.record(fields[1:])
+	case "stop":
+		r.stop()
+	case "play":
+		if len(fields) != 2 {
+			r.fail(fmt.Errorf("usage: play name"))
+			return false
+		}
+		r.eval(fields[1])
+	default:
+		r.eval(line)
+	}
+	return false
+}
+
+func (r *REPL) record(args []string) {
+	switch {
+	case len(args) != 1:
+		r.fail(fmt.Errorf("usage: record name"))
+	case r.recording != "":
+		r.fail(fmt.Errorf("already recording %q", r.recording))
+	case r.script.isReserved(args[0]):
+		r.fail(fmt.Errorf("%q is a reserved word", args[0]))
+	default:
+		if _, ok := r.script.macros[args[0]]; ok {
+			r.fail(fmt.Errorf("macro %q is already defined", args[0]))
+			return
+		}
+		if err := r.invoker.StartRecording(args[0], r.registry); err != nil {
+			r.fail(err)
+			return
+		}
+		r.recording = args[0]
+		fmt.Fprintf(r.out, "マクロ %q を記録中\n", args[0])
+	}
+}
+
+func (r *REPL) stop() {
+	if r.recording == "" {
+		r.fail(fmt.Errorf("not recording"))
+		return
+	}
+	name := r.recording
+	r.recording = ""
+	macro, err := r.invoker.StopRecording()
+	if err != nil {
+		r.fail(err)
+		return
+	}
+	steps, err := r.recordedSteps(macro)
+	if err != nil {
+		r.fail(err)
+		return
+	}
+	r.script.define(name, steps)
+	fmt.Fprintf(r.out, "マクロ %q を定義しました (%d commands)\n", name, len(steps))
+}
+
+// recordedSteps は記録したコマンドをスクリプトの文にする。
+// 一度デコードして確かめておくので、build でデコードに失敗することはない。
+func (r *REPL) recordedSteps(macro *RecordedMacro) ([]scriptStep, error) {
+	steps := make([]scriptStep, 0, len(macro.Commands))
+	for _, record := range macro.Commands {
+		if _, err := r.registry.Decode(r.editor, record); err != nil {
+			return nil, fmt.Errorf("macro %q: %w", macro.Name, err)
+		}
+		steps = append(steps, scriptStep{
+			kind: stepCommand,
+			build: func(editor *TextEditor) Command {
+				command, _ := r.registry.Decode(editor, record)
+				return command
+			},
+			token: scriptToken{kind: tokenIdent, text: record.Type},
+		})
+	}
+	return steps, nil
+}
+
+// eval は line をスクリプトとして実行する。記録中なら、実行したコマンドは invoker が記録する。
+func (r *REPL) eval(line string) {
+	steps, err := r.script.parse(line)
+	if err != nil {
+		r.fail(err)
+		return
+	}
+	for _, step := range steps {
+		if err := step.run(r.editor, r.invoker); err != nil {
+			r.fail(err)
+			break
+		}
+	}
+	r.show()
+}
+
+func (r *REPL) show() {
+	fmt.Fprintf(r.out, "内容: \"%s\"\n", r.editor.GetContent())
+}
+
+// fail はエラーを表示する。ScriptError の行は入力全体での行番号に直す。
+func (r *REPL) fail(err error) {
+	if scriptErr, ok := err.(*ScriptError); ok && r.line > 0 {
+		scriptErr.Line += r.line - 1
+	}
+	fmt.Fprintf(r.out, "エラー: %v\n", err)
+}
+
+func ExecREPL() {
+	fmt.Println("=== Editor REPL Demo ===")
+
+	input := strings.NewReader(`write "Hello "
+write "World"
+replace "World" "Go"
+undo
+redo
+record sign
+write "\n-- "; write "Gopher"
+stop
+clear
+play sign
+delete
+history
+quit
+write "never"
+`)
+	repl := NewREPL(NewTextEditor(), NewCommandInvoker(), os.Stdout)
+	if err := repl.Run(input); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+
+	fmt.Println("\n=== Demo completed ===")
+}
+
+// ExecInteractiveREPL は標準入力から REPL を動かす
+func ExecInteractiveREPL() {
+	repl := NewREPL(NewTextEditor(), NewCommandInvoker(), os.Stdout)
+	if err := repl.Run(os.Stdin); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+}
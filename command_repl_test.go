@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestREPLRecordingDropsUndoneCommands(t *testing.T) {
+	input := strings.NewReader(`record m
+write "a"
+undo
+write "b"
+stop
+clear
+play m
+quit
+`)
+	var out bytes.Buffer
+	editor := NewTextEditor()
+	repl := NewREPL(editor, NewCommandInvoker(), &out)
+	if err := repl.Run(input); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if strings.Contains(out.String(), "エラー") {
+		t.Fatalf("output has an error:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `マクロ "m" を定義しました (1 commands)`) {
+		t.Errorf("output does not define m with 1 command:\n%s", out.String())
+	}
+	if got := editor.GetContent(); got != "b" {
+		t.Errorf("content after play = %q, want %q", got, "b")
+	}
+}
+
+func TestREPLQuitDiscardsRecording(t *testing.T) {
+	var out bytes.Buffer
+	invoker := NewCommandInvoker()
+	repl := NewREPL(NewTextEditor(), invoker, &out)
+	if err := repl.Run(strings.NewReader("record m\nwrite \"a\"\nquit\n")); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if invoker.Recording() {
+		t.Error("invoker is still recording after quit")
+	}
+	if !strings.Contains(out.String(), `マクロ "m" の記録を破棄しました`) {
+		t.Errorf("output:\n%s", out.String())
+	}
+}
+
+// REPL 専用のコマンドと同じ名前のマクロは、定義しても呼び出せないので作れない
+func TestREPLReservesCommandNames(t *testing.T) {
+	for name := range replKeywords {
+		for _, line := range []string{"macro " + name + ` { write "x" }`, "record " + name} {
+			var out bytes.Buffer
+			invoker := NewCommandInvoker()
+			repl := NewREPL(NewTextEditor(), invoker, &out)
+			repl.Eval(line)
+			if !strings.Contains(out.String(), "reserved word") {
+				t.Errorf("%s: output = %q, want a reserved word error", line, out.String())
+			}
+			if len(repl.script.Macros()) != 0 || invoker.Recording() {
+				t.Errorf("%s: macro was defined or recording started", line)
+			}
+		}
+	}
+	// スクリプトのキーワードも引き続き予約されている
+	var out bytes.Buffer
+	repl := NewREPL(NewTextEditor(), NewCommandInvoker(), &out)
+	repl.Eval("record write")
+	if !strings.Contains(out.String(), "reserved word") {
+		t.Errorf("record write: output = %q", out.String())
+	}
+	// ParseScript 単体では REPL のコマンド名もマクロに使える
+	if _, err := ParseScript(`macro show { write "x" }`); err != nil {
+		t.Errorf("ParseScript: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"unicode/utf8"
+)
+
+// PatternReplaceCommand は正規表現や大文字小文字を区別しない検索、置換件数・範囲の指定に対応した置換コマンド
+type PatternReplaceCommand struct {
+	editor      *TextEditor
+	pattern     string
+	replacement string
+	regexp      bool
+	ignoreCase  bool
+	// limit は先頭から置き換える件数の上限。0 ならすべて置き換える。
+	limit int
+	// scoped が true のときは start から end（単位はエディタの TextUnit）の範囲だけを置き換える
+	scoped     bool
+	start, end int
+	record     *editRecord
+	replaced   int
+}
+
+type ReplaceOption func(*PatternReplaceCommand)
+
+// WithRegexp は検索文字列を正規表現として扱う。置換文字列の $1 や ${name} はキャプチャグループに展開される。
+func WithRegexp() ReplaceOption {
+	return func(rc *PatternReplaceCommand) {
+		rc.regexp = true
+	}
+}
+
+func WithIgnoreCase() ReplaceOption {
+	return func(rc *PatternReplaceCommand) {
+		rc.ignoreCase = true
+	}
+}
+
+// WithReplaceLimit は先頭から n 件だけ置き換える
+func WithReplaceLimit(n int) ReplaceOption {
+	return func(rc *PatternReplaceCommand) {
+		rc.limit = n
+	}
+}
+
+// WithReplaceRange は start から end の範囲に収まる一致だけを置き換える
+func WithReplaceRange(start, end int) ReplaceOption {
+	return func(rc *PatternReplaceCommand) {
+		rc.scoped = true
+		rc.start = start
+		rc.end = end
+	}
+}
+
+func NewPatternReplaceCommand(editor *TextEditor, pattern, replacement string, options ...ReplaceOption) *PatternReplaceCommand {
+	rc := &PatternReplaceCommand{
+		editor:      editor,
+		pattern:     pattern,
+		replacement: replacement,
+	}
+	for _, option := range options {
+		option(rc)
+	}
+	return rc
+}
+
+func (rc *PatternReplaceCommand) compile() (*regexp.Regexp, error) {
+	if rc.pattern == "" {
+		return nil, errors.New("replace: search pattern is empty")
+	}
+	if rc.limit < 0 {
+		return nil, fmt.Errorf("replace: negative limit %d", rc.limit)
+	}
+	expr := rc.pattern
+	if !rc.regexp {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if rc.ignoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+func (rc *PatternReplaceCommand) Execute() error {
+	re, err := rc.compile()
+	if err != nil {
+		return err
+	}
+	start, end := 0, rc.editor.text.Len()
+	if rc.scoped {
+		if rc.start > rc.end {
+			return fmt.Errorf("%w: %d-%d", ErrOutOfRange, rc.start, rc.end)
+		}
+		if start, err = rc.editor.toByte(rc.start); err != nil {
+			return err
+		}
+		if end, err = rc.editor.toByte(rc.end); err != nil {
+			return err
+		}
+	}
+	edits := rc.editor.patternReplaceEdits(re, rc.replacement, !rc.regexp, start, end, rc.limit)
+	record, err := rc.editor.record(edits)
+	if err != nil {
+		return err
+	}
+	rc.record = record
+	rc.replaced = len(record.edits)
+	return nil
+}
+
+func (rc *PatternReplaceCommand) Undo() error {
+	return rc.editor.revertEdits(rc.record)
+}
+
+func (rc *PatternReplaceCommand) GetDescription() string {
+	if rc.regexp {
+		return fmt.Sprintf("Replace: /%s/ -> \"%s\"", rc.pattern, rc.replacement)
+	}
+	return fmt.Sprintf("Replace: \"%s\" -> \"%s\"", rc.pattern, rc.replacement)
+}
+
+// Replaced は直前の Execute で置き換えた件数を返す
+func (rc *PatternReplaceCommand) Replaced() int {
+	return rc.replaced
+}
+
+// patternReplaceEdits は start から end のバイト範囲に収まる re の一致を置き換える変更を返す。
+// ^ や $、\b が範囲の端で一致しないよう、検索は内容全体に対して行う。
+// 範囲の先頭をまたぐ一致や範囲外の一致に隠れた一致も見つかるよう、前の一致の後ろから1件ずつ探す。
+// literal が false なら replacement のキャプチャグループを展開する。limit が 0 なら件数を制限しない。
+func (te *TextEditor) patternReplaceEdits(re *regexp.Regexp, replacement string, literal bool, start, end, limit int) []textEdit {
+	content := te.text.String()
+	// 途中から探すときは直前の1文字を読ませ、\b や (?m)^ がその文字を見て判定できるようにする
+	withContext := regexp.MustCompile(`(?s:.)(?:` + re.String() + `)`)
+	edits := make([]textEdit, 0)
+	shift := 0
+	previous := -1
+	for pos := start; pos <= end; {
+		if limit > 0 && len(edits) == limit {
+			break
+		}
+		match := nextMatch(re, withContext, content, pos)
+		if match == nil || match[0] > end {
+			break
+		}
+		from, to := match[0], match[1]
+		// 一致しなかった位置の次の文字から探し直す
+		_, size := utf8.DecodeRuneInString(content[from:])
+		pos = from + max(1, size)
+		if to > end || (from == to && from == previous) {
+			continue
+		}
+		// 文字の途中（結合文字の前など）で一致した箇所は置き換えない
+		if !te.text.IsBoundary(te.unit, from) || !te.text.IsBoundary(te.unit, to) {
+			continue
+		}
+		if from < to {
+			pos, previous = to, to
+		}
+		inserted := replacement
+		if !literal {
+			inserted = string(re.ExpandString(nil, replacement, content, match))
+		}
+		removed := content[from:to]
+		if removed == "" && inserted == "" {
+			continue
+		}
+		edits = append(edits, textEdit{pos: from + shift, removed: removed, inserted: inserted})
+		shift += len(inserted) - len(removed)
+	}
+	return edits
+}
+
+// nextMatch は content のバイト位置 pos 以降で最初に始まる re の一致を、content 上の位置で返す。
+// withContext は re の前に任意の1文字を付けた正規表現で、pos の直前の文字から探すのに使う。
+func nextMatch(re, withContext *regexp.Regexp, content string, pos int) []int {
+	if pos == 0 {
+		return re.FindStringSubmatchIndex(content)
+	}
+	if pos > len(content) {
+		return nil
+	}
+	_, size := utf8.DecodeLastRuneInString(content[:pos])
+	match := withContext.FindStringSubmatchIndex(content[pos-size:])
+	if match == nil {
+		return nil
+	}
+	for k, index := range match {
+		if index >= 0 {
+			match[k] = index + pos - size
+		}
+	}
+	_, size = utf8.DecodeRuneInString(content[match[0]:])
+	match[0] += size
+	return match
+}
+
+func ExecPatternReplace() {
+	fmt.Println("=== Pattern Replace Demo ===")
+
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithMiddleware(LoggingMiddleware(os.Stdout)))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "go Go GO; 2024-01-15, 2025-03-09"))
+	editor.Print()
+
+	replace := func(command *PatternReplaceCommand) {
+		if err := invoker.ExecuteCommand(command); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			return
+		}
+		fmt.Printf("%d件置換\n", command.Replaced())
+		editor.Print()
+	}
+
+	fmt.Println("\n--- 大文字小文字を区別しない ---")
+	replace(NewPatternReplaceCommand(editor, "go", "Gopher", WithIgnoreCase()))
+
+	fmt.Println("\n--- 先頭の1件だけ ---")
+	invoker.UndoLastCommand()
+	replace(NewPatternReplaceCommand(editor, "go", "Gopher", WithIgnoreCase(), WithReplaceLimit(1)))
+
+	fmt.Println("\n--- 正規表現とキャプチャグループ ---")
+	replace(NewPatternReplaceCommand(editor, `(\d{4})-(\d{2})-(\d{2})`, "$3/$2/$1", WithRegexp()))
+
+	fmt.Println("\n--- 範囲を指定 ---")
+	replace(NewPatternReplaceCommand(editor, "o", "0", WithReplaceRange(0, 10)))
+
+	fmt.Println("\n--- 不正な正規表現 ---")
+	replace(NewPatternReplaceCommand(editor, "(", "", WithRegexp()))
+
+	fmt.Println("\n--- すべて取り消し ---")
+	for invoker.CanUndo() {
+		invoker.UndoLastCommand()
+	}
+	editor.Print()
+
+	fmt.Println("\n=== Demo completed ===")
+}
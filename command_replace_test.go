@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+// 範囲を指定しても、^ や $、\b は範囲の端ではなく内容全体の位置で判定する
+func TestPatternReplaceRangeUsesWholeText(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		pattern    string
+		start, end int
+		want       string
+	}{
+		{"word boundary inside a word", "xfoo", `\bfoo`, 1, 4, "xfoo"},
+		{"word boundary after a space", "x foo", `\bfoo`, 2, 5, "x BAR"},
+		{"start of text", "ba", `^a`, 1, 2, "ba"},
+		{"end of text", "ab", `a$`, 0, 1, "ab"},
+		{"end of text inside range", "xab", `b$`, 1, 3, "xaBAR"},
+		{"match crossing the range end", "foofoo", `foo`, 0, 4, "BARfoo"},
+		{"match crossing the range start", "foofoo", `foo`, 1, 6, "fooBAR"},
+		{"match hidden by one crossing the range start", "aaaa", `aa`, 1, 3, "aBARa"},
+		{"word boundary after a hidden match", "ab b", `\bb|ab`, 1, 4, "ab BAR"},
+	}
+	for _, tt := range tests {
+		editor := NewTextEditor()
+		editor.SetContent(tt.content)
+		command := NewPatternReplaceCommand(editor, tt.pattern, "BAR", WithRegexp(), WithReplaceRange(tt.start, tt.end))
+		if err := command.Execute(); err != nil {
+			t.Fatalf("%s: Execute: %v", tt.name, err)
+		}
+		if got := editor.GetContent(); got != tt.want {
+			t.Errorf("%s: content = %q, want %q", tt.name, got, tt.want)
+		}
+		if err := command.Undo(); err != nil {
+			t.Fatalf("%s: Undo: %v", tt.name, err)
+		}
+		if got := editor.GetContent(); got != tt.content {
+			t.Errorf("%s: content after undo = %q, want %q", tt.name, got, tt.content)
+		}
+	}
+}
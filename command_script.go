@@ -0,0 +1,520 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ScriptError はスクリプトの解析・実行で起きたエラーと、その位置（1 から数える行と文字）
+type ScriptError struct {
+	Line   int
+	Column int
+	Msg    string
+	Err    error
+}
+
+func (e *ScriptError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%d:%d: %s: %v", e.Line, e.Column, e.Msg, e.Err)
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+type scriptTokenKind int
+
+const (
+	tokenEOF scriptTokenKind = iota
+	tokenIdent
+	tokenString
+	tokenInt
+	tokenSeparator
+	tokenLBrace
+	tokenRBrace
+)
+
+func (k scriptTokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of script"
+	case tokenIdent:
+		return "name"
+	case tokenString:
+		return "string"
+	case tokenInt:
+		return "number"
+	case tokenSeparator:
+		return "separator"
+	case tokenLBrace:
+		return "\"{\""
+	case tokenRBrace:
+		return "\"}\""
+	default:
+		return "unknown"
+	}
+}
+
+type scriptToken struct {
+	kind scriptTokenKind
+	// text は識別子・数値ならそのまま、文字列ならエスケープを解いた内容
+	text   string
+	line   int
+	column int
+}
+
+func (t scriptToken) errorf(format string, args ...any) *ScriptError {
+	return &ScriptError{Line: t.line, Column: t.column, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (t scriptToken) describe() string {
+	switch t.kind {
+	case tokenIdent, tokenInt:
+		return strconv.Quote(t.text)
+	case tokenSeparator:
+		return "end of statement"
+	default:
+		return t.kind.String()
+	}
+}
+
+// lexScript はスクリプトをトークンに分ける。改行と ";" はどちらも文の区切りになり、"#" から行末まではコメント。
+func lexScript(src string) ([]scriptToken, error) {
+	tokens := make([]scriptToken, 0)
+	line, column := 1, 1
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		token := scriptToken{line: line, column: column}
+		advance := func(n int) {
+			column += utf8.RuneCountInString(src[i : i+n])
+			i += n
+		}
+		switch {
+		case r == '\n':
+			token.kind = tokenSeparator
+			tokens = append(tokens, token)
+			i++
+			line, column = line+1, 1
+		case r == ';':
+			token.kind = tokenSeparator
+			tokens = append(tokens, token)
+			advance(1)
+		case r == '{':
+			token.kind = tokenLBrace
+			tokens = append(tokens, token)
+			advance(1)
+		case r == '}':
+			token.kind = tokenRBrace
+			tokens = append(tokens, token)
+			advance(1)
+		case r == '#':
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			advance(end)
+		case unicode.IsSpace(r):
+			advance(size)
+		case r == '"':
+			n, err := scanScriptString(src[i:])
+			if err != nil {
+				return nil, token.errorf("%s", err)
+			}
+			text, err := strconv.Unquote(src[i : i+n])
+			if err != nil {
+				return nil, token.errorf("invalid string literal %s", src[i:i+n])
+			}
+			token.kind = tokenString
+			token.text = text
+			tokens = append(tokens, token)
+			advance(n)
+		case r >= '0' && r <= '9':
+			n := 0
+			for i+n < len(src) && src[i+n] >= '0' && src[i+n] <= '9' {
+				n++
+			}
+			token.kind = tokenInt
+			token.text = src[i : i+n]
+			tokens = append(tokens, token)
+			advance(n)
+		case r == '_' || unicode.IsLetter(r):
+			n := 0
+			for i+n < len(src) {
+				next, nextSize := utf8.DecodeRuneInString(src[i+n:])
+				if next != '_' && !unicode.IsLetter(next) && !unicode.IsDigit(next) {
+					break
+				}
+				n += nextSize
+			}
+			token.kind = tokenIdent
+			token.text = src[i : i+n]
+			tokens = append(tokens, token)
+			advance(n)
+		default:
+			return nil, token.errorf("unexpected character %q", r)
+		}
+	}
+	tokens = append(tokens, scriptToken{kind: tokenEOF, line: line, column: column})
+	return tokens, nil
+}
+
+// scanScriptString は src の先頭の文字列リテラルのバイト数を返す。リテラルは行をまたげない。
+func scanScriptString(src string) (int, error) {
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		case '\n':
+			return 0, fmt.Errorf("unterminated string")
+		}
+	}
+	return 0, fmt.Errorf("unterminated string")
+}
+
+type scriptStepKind int
+
+const (
+	stepCommand scriptStepKind = iota
+	stepUndo
+	stepRedo
+)
+
+// scriptStep はスクリプトの1文。コマンドは実行のたびに build で新しく作る。
+type scriptStep struct {
+	kind  scriptStepKind
+	build func(editor *TextEditor) Command
+	token scriptToken
+}
+
+// Script は解析済みのスクリプト。同じスクリプトを別のエディタに何度でも適用できる。
+type Script struct {
+	steps  []scriptStep
+	macros map[string][]scriptStep
+	names  []string
+	// reserved はスクリプトのキーワードのほかに、マクロの名前に使えない語
+	reserved map[string]bool
+}
+
+var scriptKeywords = map[string]bool{
+	"write": true, "delete": true, "replace": true, "clear": true,
+	"undo": true, "redo": true, "macro": true,
+}
+
+// isReserved は name がマクロの名前に使えない語かどうかを返す
+func (s *Script) isReserved(name string) bool {
+	return scriptKeywords[name] || s.reserved[name]
+}
+
+type scriptParser struct {
+	tokens []scriptToken
+	pos    int
+	script *Script
+	// defined は解析中に定義したマクロ。解析に成功したときだけ script に加える。
+	defined map[string][]scriptStep
+	names   []string
+}
+
+// ParseScript はスクリプトを解析する。使える文は次のとおり。
+//
+//	write "text"              末尾に追記する
+//	delete 3                  末尾から削除する
+//	replace "old" "new"       すべて置き換える
+//	clear                     全削除
+//	undo / redo               直前のコマンドを取り消す・やり直す
+//	macro name { ... }        名前付きマクロを定義する
+//	name                      定義済みのマクロを1つのコマンドとして実行する
+func ParseScript(src string) (*Script, error) {
+	script := &Script{macros: make(map[string][]scriptStep)}
+	steps, err := script.parse(src)
+	if err != nil {
+		return nil, err
+	}
+	script.steps = steps
+	return script, nil
+}
+
+// parse は s で定義済みのマクロを使えるようにして src を解析し、src で定義したマクロを s に加える
+func (s *Script) parse(src string) ([]scriptStep, error) {
+	tokens, err := lexScript(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &scriptParser{
+		tokens:  tokens,
+		script:  s,
+		defined: make(map[string][]scriptStep),
+	}
+	steps, err := p.parseBlock(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range p.names {
+		s.define(name, p.defined[name])
+	}
+	return steps, nil
+}
+
+func (s *Script) define(name string, body []scriptStep) {
+	if _, ok := s.macros[name]; !ok {
+		s.names = append(s.names, name)
+	}
+	s.macros[name] = body
+}
+
+func (p *scriptParser) macro(name string) ([]scriptStep, bool) {
+	if body, ok := p.defined[name]; ok {
+		return body, true
+	}
+	body, ok := p.script.macros[name]
+	return body, ok
+}
+
+func (p *scriptParser) peek() scriptToken {
+	return p.tokens[p.pos]
+}
+
+func (p *scriptParser) next() scriptToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *scriptParser) expect(kind scriptTokenKind, context string) (scriptToken, error) {
+	token := p.next()
+	if token.kind != kind {
+		return token, token.errorf("%s: expected %s, got %s", context, kind, token.describe())
+	}
+	return token, nil
+}
+
+// parseBlock は文を並べたものを解析する。macro が nil でなければ、そのマクロの本体として "}" まで読む。
+func (p *scriptParser) parseBlock(macro *scriptToken) ([]scriptStep, error) {
+	steps := make([]scriptStep, 0)
+	for {
+		token := p.peek()
+		switch token.kind {
+		case tokenSeparator:
+			p.next()
+			continue
+		case tokenEOF:
+			if macro != nil {
+				return nil, macro.errorf("macro %q is not closed", macro.text)
+			}
+			return steps, nil
+		case tokenRBrace:
+			if macro == nil {
+				return nil, token.errorf("unexpected \"}\"")
+			}
+			p.next()
+			return steps, nil
+		}
+
+		step, err := p.parseStatement(macro != nil)
+		if err != nil {
+			return nil, err
+		}
+		if step != nil {
+			steps = append(steps, *step)
+		}
+		if after := p.peek(); after.kind != tokenSeparator && after.kind != tokenEOF && after.kind != tokenRBrace {
+			return nil, after.errorf("expected end of statement, got %s", after.describe())
+		}
+	}
+}
+
+// parseStatement は1文を解析する。マクロの定義は実行する文にならないので nil を返す。
+func (p *scriptParser) parseStatement(inMacro bool) (*scriptStep, error) {
+	token, err := p.expect(tokenIdent, "statement")
+	if err != nil {
+		return nil, err
+	}
+	step := &scriptStep{kind: stepCommand, token: token}
+	switch token.text {
+	case "write":
+		text, err := p.expect(tokenString, "write")
+		if err != nil {
+			return nil, err
+		}
+		step.build = func(editor *TextEditor) Command { return NewWriteCommand(editor, text.text) }
+	case "delete":
+		length, err := p.expect(tokenInt, "delete")
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(length.text)
+		if err != nil {
+			return nil, length.errorf("delete: invalid length %s", length.text)
+		}
+		step.build = func(editor *TextEditor) Command { return NewDeleteCommand(editor, n) }
+	case "replace":
+		old, err := p.expect(tokenString, "replace")
+		if err != nil {
+			return nil, err
+		}
+		if old.text == "" {
+			return nil, old.errorf("replace: search text is empty")
+		}
+		replacement, err := p.expect(tokenString, "replace")
+		if err != nil {
+			return nil, err
+		}
+		step.build = func(editor *TextEditor) Command { return NewReplaceCommand(editor, old.text, replacement.text) }
+	case "clear":
+		step.build = func(editor *TextEditor) Command { return NewClearCommand(editor) }
+	case "undo", "redo":
+		if inMacro {
+			return nil, token.errorf("%s cannot be used in a macro", token.text)
+		}
+		step.kind = stepUndo
+		if token.text == "redo" {
+			step.kind = stepRedo
+		}
+	case "macro":
+		return nil, p.parseMacro(token, inMacro)
+	default:
+		body, ok := p.macro(token.text)
+		if !ok {
+			return nil, token.errorf("unknown command or macro %q", token.text)
+		}
+		name := token.text
+		step.build = func(editor *TextEditor) Command { return buildScriptMacro(name, body, editor) }
+	}
+	return step, nil
+}
+
+func (p *scriptParser) parseMacro(keyword scriptToken, inMacro bool) error {
+	if inMacro {
+		return keyword.errorf("macro cannot be defined in a macro")
+	}
+	name, err := p.expect(tokenIdent, "macro")
+	if err != nil {
+		return err
+	}
+	if p.script.isReserved(name.text) {
+		return name.errorf("macro: %q is a reserved word", name.text)
+	}
+	if _, ok := p.macro(name.text); ok {
+		return name.errorf("macro %q is already defined", name.text)
+	}
+	if _, err := p.expect(tokenLBrace, "macro "+name.text); err != nil {
+		return err
+	}
+	body, err := p.parseBlock(&name)
+	if err != nil {
+		return err
+	}
+	p.defined[name.text] = body
+	p.names = append(p.names, name.text)
+	return nil
+}
+
+func buildScriptMacro(name string, body []scriptStep, editor *TextEditor) Command {
+	macro := NewMacroCommand(name)
+	for _, step := range body {
+		macro.AddCommand(step.build(editor))
+	}
+	return macro
+}
+
+// Macros は定義されたマクロの名前を定義順に返す
+func (s *Script) Macros() []string {
+	return append([]string(nil), s.names...)
+}
+
+// Macro は名前付きマクロを editor に対する MacroCommand として作る
+func (s *Script) Macro(name string, editor *TextEditor) (*MacroCommand, error) {
+	body, ok := s.macros[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown macro %q", name)
+	}
+	return buildScriptMacro(name, body, editor).(*MacroCommand), nil
+}
+
+// Run はスクリプトの文を順に invoker で実行する。失敗した文で止まり、その位置を含む ScriptError を返す。
+func (s *Script) Run(editor *TextEditor, invoker *CommandInvoker) error {
+	for _, step := range s.steps {
+		if err := step.run(editor, invoker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (step scriptStep) run(editor *TextEditor, invoker *CommandInvoker) error {
+	var err error
+	switch step.kind {
+	case stepUndo:
+		err = invoker.UndoLastCommand()
+	case stepRedo:
+		err = invoker.RedoLastCommand()
+	default:
+		err = invoker.ExecuteCommand(step.build(editor))
+	}
+	if err != nil {
+		return &ScriptError{Line: step.token.line, Column: step.token.column, Msg: step.token.text, Err: err}
+	}
+	return nil
+}
+
+// RunScript は src を解析して実行する
+func RunScript(src string, editor *TextEditor, invoker *CommandInvoker) error {
+	script, err := ParseScript(src)
+	if err != nil {
+		return err
+	}
+	return script.Run(editor, invoker)
+}
+
+func ExecScript() {
+	fmt.Println("=== Editor Script Demo ===")
+
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithMiddleware(LoggingMiddleware(os.Stdout)))
+
+	src := `# あいさつを書いて直す
+write "Hello "; write "World"
+replace "World" "Go"
+delete 2; undo
+
+macro sign {
+	write "\n-- "
+	write "Gopher"
+}
+sign
+`
+	if err := RunScript(src, editor, invoker); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+	editor.Print()
+	invoker.ShowHistory()
+
+	fmt.Println("\n--- 解析エラー ---")
+	for _, bad := range []string{
+		"write \"ok\"\nreplace \"a\"",
+		"write \"unterminated",
+		"macro m { undo }",
+		"write \"x\" 3",
+		"greet",
+	} {
+		if _, err := ParseScript(bad); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+		}
+	}
+
+	fmt.Println("\n--- 実行時エラー ---")
+	if err := RunScript("clear\nundo\nundo\nundo", NewTextEditor(), NewCommandInvoker()); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+
+	fmt.Println("\n=== Demo completed ===")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseScriptErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"missing argument at the end", "write \"ok\"\nreplace \"a\"", `2:12: replace: expected string, got end of script`},
+		{"unterminated string", `write "unterminated`, `1:7: unterminated string`},
+		{"string across lines", "write \"a\nb\"", `1:7: unterminated string`},
+		{"invalid escape", `write "\q"`, `1:7: invalid string literal "\q"`},
+		{"wrong argument type", `  write 3`, `1:9: write: expected string, got "3"`},
+		{"extra argument", `write "x" 3`, `1:11: expected end of statement, got "3"`},
+		{"extra string", `write "x" "y"`, `1:11: expected end of statement, got string`},
+		{"delete with a string", `delete "x"`, `1:8: delete: expected number, got string`},
+		{"delete overflow", `delete 99999999999999999999`, `1:8: delete: invalid length 99999999999999999999`},
+		{"empty search text", `replace "" "x"`, `1:9: replace: search text is empty`},
+		// 列は rune で数える
+		{"unexpected character after multibyte", `あ @`, `1:3: unexpected character '@'`},
+		{"unknown command", `greet`, `1:1: unknown command or macro "greet"`},
+		{"unknown command after comments", "write \"ok\" # c\n\t# c\n  greet", `3:3: unknown command or macro "greet"`},
+		{"statement starting with a brace", `{`, `1:1: statement: expected name, got "{"`},
+		{"statement starting with a string", `"あ" write`, `1:1: statement: expected name, got string`},
+		{"stray closing brace", `}`, `1:1: unexpected "}"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseScript(tt.src)
+		var scriptErr *ScriptError
+		if !errors.As(err, &scriptErr) {
+			t.Errorf("%s: error = %v, want a ScriptError", tt.name, err)
+			continue
+		}
+		if got := err.Error(); got != tt.want {
+			t.Errorf("%s: error = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseScriptMacroErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"undo in a macro", `macro m { undo }`, `1:11: undo cannot be used in a macro`},
+		{"redo in a macro", `macro m { redo }`, `1:11: redo cannot be used in a macro`},
+		{"nested definition", `macro m { macro n { } }`, `1:11: macro cannot be defined in a macro`},
+		{"reserved name", `macro write { }`, `1:7: macro: "write" is a reserved word`},
+		{"redefinition", `macro m { }; macro m { }`, `1:20: macro "m" is already defined`},
+		{"not closed", `macro m { write "x"`, `1:7: macro "m" is not closed`},
+		{"missing name", `macro { }`, `1:7: macro: expected name, got "{"`},
+		{"missing body", `macro m write`, `1:9: macro m: expected "{", got "write"`},
+		{"used before definition", `m; macro m { }`, `1:1: unknown command or macro "m"`},
+		{"recursive", `macro m { m }`, `1:11: unknown command or macro "m"`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseScript(tt.src); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: error = %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestScriptStringEscapes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`write "a\tb"`, "a\tb"},
+		{`write "line\n"`, "line\n"},
+		{`write "say \"hi\""`, `say "hi"`},
+		{`write "back\\slash"`, `back\slash`},
+		{`write "あ\x41"`, "あA"},
+		{`write "# not a comment"; write ";"`, "# not a comment;"},
+		{`write "日本語"`, "日本語"},
+	}
+	for _, tt := range tests {
+		editor := NewTextEditor()
+		if err := RunScript(tt.src, editor, NewCommandInvoker()); err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got := editor.GetContent(); got != tt.want {
+			t.Errorf("%s: content = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+// 定義済みのマクロを別のマクロから呼ぶと、全体が1件の履歴になる
+func TestScriptNestedMacros(t *testing.T) {
+	src := `
+macro greet { write "Hello" }
+macro sign {
+	greet; write ", "
+	write "Go"
+}
+sign
+sign
+undo
+`
+	script, err := ParseScript(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(script.Macros(), ","); got != "greet,sign" {
+		t.Errorf("Macros = %s", got)
+	}
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker()
+	if err := script.Run(editor, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if got := editor.GetContent(); got != "Hello, Go" {
+		t.Errorf("content = %q", got)
+	}
+	if got := len(invoker.History()); got != 2 {
+		t.Errorf("history has %d entries, want the undone sign and one more", got)
+	}
+
+	// 同じマクロを別のエディタに何度でも作れる
+	other := NewTextEditor()
+	macro, err := script.Macro("sign", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := macro.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if got := other.GetContent(); got != "Hello, Go" {
+		t.Errorf("other editor = %q", got)
+	}
+	if _, err := script.Macro("missing", other); err == nil {
+		t.Error("Macro(missing): want an error")
+	}
+}
+
+func TestScriptRunErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    string
+		wantErr error
+		content string
+	}{
+		{"write \"a\"\nundo\nundo", `3:1: undo: no command to undo`, ErrNothingToUndo, ""},
+		{`write "a"; redo`, `1:12: redo: no command to redo`, ErrNothingToRedo, "a"},
+	}
+	for _, tt := range tests {
+		editor := NewTextEditor()
+		err := RunScript(tt.src, editor, NewCommandInvoker())
+		if err == nil || err.Error() != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%q: error = %v, want %s", tt.src, err, tt.want)
+		}
+		if got := editor.GetContent(); got != tt.content {
+			t.Errorf("%q: content = %q, want %q (stopped at the error)", tt.src, got, tt.content)
+		}
+	}
+}
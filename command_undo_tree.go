@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrUnknownNode = errors.New("undo tree: unknown node")
+
+// undoNode は取り消しツリーの1ノード。ルートはコマンドを持たない初期状態を表す。
+type undoNode struct {
+	id       int
+	command  Command
+	parent   *undoNode
+	children []*undoNode
+	// redo は RedoLastCommand で進む子。最後に通った枝を指す。
+	redo       *undoNode
+	executedAt time.Time
+	// size は履歴の上限判定に使う、このノードのおおよそのバイト数
+	size int
+}
+
+// path はルートの次からこのノードまでのノードを返す
+func (n *undoNode) path() []*undoNode {
+	path := make([]*undoNode, 0)
+	for node := n; node.parent != nil; node = node.parent {
+		path = append(path, node)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+func (n *undoNode) depth() int {
+	depth := 0
+	for node := n; node.parent != nil; node = node.parent {
+		depth++
+	}
+	return depth
+}
+
+type UndoNodeInfo struct {
+	ID          int
+	ParentID    int
+	Description string
+	ExecutedAt  time.Time
+	Depth       int
+	Children    []int
+	Current     bool
+}
+
+func (ci *CommandInvoker) nodeInfo(node *undoNode) UndoNodeInfo {
+	info := UndoNodeInfo{
+		ID:          node.id,
+		Description: "（初期状態）",
+		ExecutedAt:  node.executedAt,
+		Depth:       node.depth(),
+		Children:    make([]int, 0, len(node.children)),
+		Current:     node == ci.current,
+	}
+	if node.parent != nil {
+		info.ParentID = node.parent.id
+		info.Description = node.command.GetDescription()
+	}
+	for _, child := range node.children {
+		info.Children = append(info.Children, child.id)
+	}
+	return info
+}
+
+func (ci *CommandInvoker) addNode(command Command) {
+	node := &undoNode{
+		id:         ci.nextID,
+		command:    command,
+		parent:     ci.current,
+		executedAt: ci.now(),
+	}
+	ci.nextID++
+	ci.current.children = append(ci.current.children, node)
+	ci.current.redo = node
+	ci.nodes[node.id] = node
+	ci.current = node
+	ci.resize(node)
+}
+
+func (ci *CommandInvoker) undoStep() error {
+	node := ci.current
+	if err := ci.handler(OperationUndo, node.command); err != nil {
+		return err
+	}
+	ci.current = node.parent
+	ci.current.redo = node
+	ci.recording.undone(node)
+	return nil
+}
+
+func (ci *CommandInvoker) redoStep(node *undoNode) error {
+	if err := ci.handler(OperationRedo, node.command); err != nil {
+		return err
+	}
+	ci.current.redo = node
+	ci.current = node
+	ci.recording.redone(node)
+	return nil
+}
+
+func (ci *CommandInvoker) node(id int) (*undoNode, error) {
+	node, ok := ci.nodes[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownNode, id)
+	}
+	return node, nil
+}
+
+// sortedNodes は削除されていないノードを ID 順に返す
+func (ci *CommandInvoker) sortedNodes() []*undoNode {
+	nodes := make([]*undoNode, 0, len(ci.nodes))
+	for _, node := range ci.nodes {
+		nodes = append(nodes, node)
+	}
+	slices.SortFunc(nodes, func(a, b *undoNode) int { return a.id - b.id })
+	return nodes
+}
+
+// CurrentNode は現在の状態を表すノードの ID を返す。初期状態は 0。
+// 履歴の上限で古いノードを捨てた後は、残っている最古の状態がルートになる。
+func (ci *CommandInvoker) CurrentNode() int {
+	return ci.current.id
+}
+
+// UndoTree は初期状態を含むすべてのノードを ID 順に返す
+func (ci *CommandInvoker) UndoTree() []UndoNodeInfo {
+	infos := make([]UndoNodeInfo, 0, len(ci.nodes))
+	for _, node := range ci.sortedNodes() {
+		infos = append(infos, ci.nodeInfo(node))
+	}
+	return infos
+}
+
+// Branches はツリーの葉、つまりそれぞれの枝の最新の状態を返す
+func (ci *CommandInvoker) Branches() []UndoNodeInfo {
+	infos := make([]UndoNodeInfo, 0)
+	for _, node := range ci.sortedNodes() {
+		if len(node.children) == 0 {
+			infos = append(infos, ci.nodeInfo(node))
+		}
+	}
+	return infos
+}
+
+// RedoBranches は現在位置からやり直せる枝（現在ノードの子）を返す
+func (ci *CommandInvoker) RedoBranches() []UndoNodeInfo {
+	infos := make([]UndoNodeInfo, 0, len(ci.current.children))
+	for _, child := range ci.current.children {
+		infos = append(infos, ci.nodeInfo(child))
+	}
+	return infos
+}
+
+// SelectRedoBranch は RedoLastCommand で進む枝を、現在ノードの子 id に切り替える
+func (ci *CommandInvoker) SelectRedoBranch(id int) error {
+	node, err := ci.node(id)
+	if err != nil {
+		return err
+	}
+	if node.parent != ci.current {
+		return fmt.Errorf("%w: %d is not a child of %d", ErrUnknownNode, id, ci.current.id)
+	}
+	if err := ci.journal.appendNode(JournalSelect, id); err != nil {
+		return err
+	}
+	ci.current.redo = node
+	return nil
+}
+
+// JumpTo は共通の祖先まで取り消してから目的のノードまでやり直し、任意の状態へ移動する。
+// 途中で失敗した場合は、そこまで移動した状態のままエラーを返す。
+func (ci *CommandInvoker) JumpTo(id int) error {
+	target, err := ci.node(id)
+	if err != nil {
+		return err
+	}
+	err = ci.walkTo(target)
+	return errors.Join(err, ci.journal.appendNode(JournalJump, ci.current.id))
+}
+
+func (ci *CommandInvoker) walkTo(target *undoNode) error {
+	ancestors := make(map[*undoNode]bool)
+	for node := target; node != nil; node = node.parent {
+		ancestors[node] = true
+	}
+	for !ancestors[ci.current] {
+		if err := ci.undoStep(); err != nil {
+			return err
+		}
+	}
+	path := target.path()
+	for _, node := range path[ci.current.depth():] {
+		if err := ci.redoStep(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ci *CommandInvoker) ShowUndoTree() {
+	fmt.Println("\n--- 取り消しツリー ---")
+	ci.printUndoNode(ci.root, 0)
+	fmt.Println("---")
+}
+
+func (ci *CommandInvoker) printUndoNode(node *undoNode, depth int) {
+	info := ci.nodeInfo(node)
+	marker := ""
+	if info.Current {
+		marker = " <- 現在"
+	}
+	fmt.Printf("%s#%d %s%s\n", strings.Repeat("  ", depth), info.ID, info.Description, marker)
+	for _, child := range node.children {
+		ci.printUndoNode(child, depth+1)
+	}
+}
+
+func ExecUndoTree() {
+	fmt.Println("=== Undo Tree Demo ===")
+
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker(WithMiddleware(LoggingMiddleware(os.Stdout)))
+
+	invoker.ExecuteCommand(NewWriteCommand(editor, "Hello "))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "World"))
+	editor.Print()
+
+	fmt.Println("\n--- 取り消して別の枝を作る ---")
+	invoker.UndoLastCommand()
+	invoker.ExecuteCommand(NewWriteCommand(editor, "Gopher"))
+	editor.Print()
+	invoker.ShowUndoTree()
+
+	fmt.Println("\n--- 枝の一覧 ---")
+	for _, branch := range invoker.Branches() {
+		fmt.Printf("#%d %s (深さ %d)\n", branch.ID, branch.Description, branch.Depth)
+	}
+
+	fmt.Println("\n--- 最初の枝へジャンプ ---")
+	invoker.JumpTo(2)
+	editor.Print()
+
+	fmt.Println("\n--- 分岐点でやり直す枝を切り替える ---")
+	invoker.UndoLastCommand()
+	for _, branch := range invoker.RedoBranches() {
+		fmt.Printf("やり直し候補: #%d %s\n", branch.ID, branch.Description)
+	}
+	invoker.SelectRedoBranch(3)
+	invoker.RedoLastCommand()
+	editor.Print()
+
+	fmt.Println("\n--- 初期状態へジャンプ ---")
+	invoker.JumpTo(0)
+	editor.Print()
+	invoker.ShowUndoTree()
+
+	fmt.Println("\n=== Demo completed ===")
+}
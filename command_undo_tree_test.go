@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// newBranchedTree は次のツリーを作る。#2 と #3 は #1 から分かれた枝。
+//
+//	#0 ""
+//	└ #1 "a"
+//	  ├ #2 "ab"
+//	  │ └ #4 "abd"
+//	  └ #3 "ac"
+func newBranchedTree(t *testing.T) (*TextEditor, *CommandInvoker) {
+	t.Helper()
+	editor := NewTextEditor()
+	invoker := NewCommandInvoker()
+	invoker.ExecuteCommand(NewWriteCommand(editor, "a"))
+	invoker.ExecuteCommand(NewWriteCommand(editor, "b"))
+	invoker.UndoLastCommand()
+	invoker.ExecuteCommand(NewWriteCommand(editor, "c"))
+	if err := invoker.JumpTo(2); err != nil {
+		t.Fatal(err)
+	}
+	invoker.ExecuteCommand(NewWriteCommand(editor, "d"))
+	if got := editor.GetContent(); got != "abd" {
+		t.Fatalf("content = %q, want %q", got, "abd")
+	}
+	return editor, invoker
+}
+
+func TestUndoTreeJumpAcrossBranches(t *testing.T) {
+	editor, invoker := newBranchedTree(t)
+	want := map[int]string{0: "", 1: "a", 2: "ab", 3: "ac", 4: "abd"}
+	for _, id := range []int{3, 4, 0, 2, 3, 1, 4} {
+		if err := invoker.JumpTo(id); err != nil {
+			t.Fatalf("JumpTo(%d): %v", id, err)
+		}
+		if got := editor.GetContent(); got != want[id] {
+			t.Errorf("JumpTo(%d): content = %q, want %q", id, got, want[id])
+		}
+		if got := invoker.CurrentNode(); got != id {
+			t.Errorf("JumpTo(%d): current node = %d", id, got)
+		}
+	}
+	if err := invoker.JumpTo(9); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("JumpTo(9): error = %v, want ErrUnknownNode", err)
+	}
+
+	var leaves []int
+	for _, info := range invoker.Branches() {
+		leaves = append(leaves, info.ID)
+	}
+	if !slices.Equal(leaves, []int{3, 4}) {
+		t.Errorf("Branches() = %v, want [3 4]", leaves)
+	}
+}
+
+func TestUndoTreeSelectRedoBranch(t *testing.T) {
+	editor, invoker := newBranchedTree(t)
+	invoker.JumpTo(1)
+
+	var children []int
+	for _, info := range invoker.RedoBranches() {
+		children = append(children, info.ID)
+	}
+	if !slices.Equal(children, []int{2, 3}) {
+		t.Fatalf("RedoBranches() = %v, want [2 3]", children)
+	}
+
+	// 最後に通った枝（#2）にやり直す
+	invoker.RedoLastCommand()
+	if got := editor.GetContent(); got != "ab" {
+		t.Errorf("redo: content = %q, want %q", got, "ab")
+	}
+	invoker.UndoLastCommand()
+
+	if err := invoker.SelectRedoBranch(3); err != nil {
+		t.Fatal(err)
+	}
+	invoker.RedoLastCommand()
+	if got := editor.GetContent(); got != "ac" {
+		t.Errorf("redo after selecting #3: content = %q, want %q", got, "ac")
+	}
+	if invoker.CanRedo() {
+		t.Error("CanRedo() at a leaf")
+	}
+
+	// 子でないノードは選べない
+	invoker.JumpTo(1)
+	if err := invoker.SelectRedoBranch(4); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("SelectRedoBranch(4) from #1: error = %v, want ErrUnknownNode", err)
+	}
+	// 枝を選び直しても、その先の子孫は残っている
+	invoker.SelectRedoBranch(2)
+	invoker.RedoLastCommand()
+	invoker.RedoLastCommand()
+	if got := editor.GetContent(); got != "abd" {
+		t.Errorf("redo twice along #2: content = %q, want %q", got, "abd")
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrUnknownBuffer = errors.New("workspace: unknown buffer")
+	ErrBufferExists  = errors.New("workspace: buffer already open")
+	ErrNoCommand     = errors.New("workspace: no command to execute")
+)
+
+// workspaceScope はバッファをまたぐマクロの履歴を表示するときの名前
+const workspaceScope = "*"
+
+type workspaceBuffer struct {
+	name    string
+	editor  *TextEditor
+	invoker *CommandInvoker
+}
+
+// historyKey は取り消しの単位（どの履歴のどのノードか）を表す
+type historyKey struct {
+	invoker *CommandInvoker
+	node    int
+}
+
+// Workspace は名前付きの TextEditor を複数持ち、それぞれのバッファに専用の CommandInvoker を割り当てる。
+// バッファをまたぐマクロはワークスペース自身の CommandInvoker に1件として積むので、まとめて取り消せる。
+// 全体の取り消しは、すべての履歴のうち最後に実行されたものから順に取り消す。
+type Workspace struct {
+	buffers []*workspaceBuffer
+	macros  *CommandInvoker
+	options []InvokerOption
+	// sequence は各ノードを実行した順番。全体の取り消しで最新のものを選ぶのに使う。
+	// 全体の取り消し・やり直しと全体の履歴は、ここにあるノードだけを対象にする。
+	sequence map[historyKey]int
+	next     int
+	// macroBuffers はマクロのノードごとの、そのマクロが変更したバッファ
+	macroBuffers map[int][]*workspaceBuffer
+	// redoStack は UndoAll で取り消した履歴。RedoAll はここから逆順にやり直す。
+	redoStack []*CommandInvoker
+}
+
+// NewWorkspace は options を各バッファの CommandInvoker とマクロ用の CommandInvoker に適用する
+func NewWorkspace(options ...InvokerOption) *Workspace {
+	return &Workspace{
+		macros:       NewCommandInvoker(options...),
+		options:      options,
+		sequence:     make(map[historyKey]int),
+		macroBuffers: make(map[int][]*workspaceBuffer),
+	}
+}
+
+func (ws *Workspace) buffer(name string) (*workspaceBuffer, error) {
+	for _, buffer := range ws.buffers {
+		if buffer.name == name {
+			return buffer, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownBuffer, name)
+}
+
+// Open は content を内容に持つバッファ name を開く。初期内容は取り消しの対象にならない。
+func (ws *Workspace) Open(name, content string, options ...EditorOption) (*TextEditor, error) {
+	if _, err := ws.buffer(name); err == nil {
+		return nil, fmt.Errorf("%w: %q", ErrBufferExists, name)
+	}
+	editor := NewTextEditor(options...)
+	editor.SetContent(content)
+	ws.buffers = append(ws.buffers, &workspaceBuffer{
+		name:    name,
+		editor:  editor,
+		invoker: NewCommandInvoker(ws.options...),
+	})
+	return editor, nil
+}
+
+// Close はバッファ name を閉じ、その履歴も捨てる。
+// そのバッファを変更したマクロは、他のバッファの分だけを取り消すことができないので、
+// 全体の取り消し・やり直しと全体の履歴から外す。マクロの履歴はそこより前には戻れなくなる。
+func (ws *Workspace) Close(name string) error {
+	buffer, err := ws.buffer(name)
+	if err != nil {
+		return err
+	}
+	ws.buffers = slices.DeleteFunc(ws.buffers, func(b *workspaceBuffer) bool { return b == buffer })
+	ws.redoStack = slices.DeleteFunc(ws.redoStack, func(invoker *CommandInvoker) bool { return invoker == buffer.invoker })
+	for key := range ws.sequence {
+		if key.invoker == buffer.invoker {
+			delete(ws.sequence, key)
+		}
+	}
+	for node, buffers := range ws.macroBuffers {
+		if slices.Contains(buffers, buffer) {
+			delete(ws.sequence, historyKey{ws.macros, node})
+			delete(ws.macroBuffers, node)
+		}
+	}
+	return nil
+}
+
+// Names は開いているバッファの名前を開いた順に返す
+func (ws *Workspace) Names() []string {
+	names := make([]string, 0, len(ws.buffers))
+	for _, buffer := range ws.buffers {
+		names = append(names, buffer.name)
+	}
+	return names
+}
+
+func (ws *Workspace) Editor(name string) (*TextEditor, error) {
+	buffer, err := ws.buffer(name)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.editor, nil
+}
+
+// Invoker はバッファ name の履歴を持つ CommandInvoker を返す。履歴の参照や取り消しツリーの操作に使う。
+func (ws *Workspace) Invoker(name string) (*CommandInvoker, error) {
+	buffer, err := ws.buffer(name)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.invoker, nil
+}
+
+// Execute はバッファ name のエディタに対して build で作ったコマンドを、name の履歴に積んで実行する
+func (ws *Workspace) Execute(name string, build func(editor *TextEditor) Command) error {
+	buffer, err := ws.buffer(name)
+	if err != nil {
+		return err
+	}
+	command := build(buffer.editor)
+	if command == nil {
+		return fmt.Errorf("%w: %q", ErrNoCommand, name)
+	}
+	return ws.record(buffer.invoker, command)
+}
+
+// ExecuteMacro はバッファ names のそれぞれに build で作ったコマンドを適用するマクロを、1件の履歴として実行する。
+// build が nil を返したバッファは対象外になる。どれかが失敗した場合は、適用済みのバッファも元に戻す。
+func (ws *Workspace) ExecuteMacro(description string, names []string, build func(name string, editor *TextEditor) Command) error {
+	macro := NewMacroCommand(description)
+	buffers := make([]*workspaceBuffer, 0, len(names))
+	for _, name := range names {
+		buffer, err := ws.buffer(name)
+		if err != nil {
+			return err
+		}
+		if command := build(buffer.name, buffer.editor); command != nil {
+			macro.AddCommand(command)
+			buffers = append(buffers, buffer)
+		}
+	}
+	if err := ws.record(ws.macros, macro); err != nil {
+		return err
+	}
+	ws.macroBuffers[ws.macros.CurrentNode()] = buffers
+	return nil
+}
+
+// ExecuteAll は開いているすべてのバッファに build で作ったコマンドを適用するマクロを実行する
+func (ws *Workspace) ExecuteAll(description string, build func(name string, editor *TextEditor) Command) error {
+	return ws.ExecuteMacro(description, ws.Names(), build)
+}
+
+func (ws *Workspace) record(invoker *CommandInvoker, command Command) error {
+	if err := invoker.ExecuteCommand(command); err != nil {
+		return err
+	}
+	// 結合された場合も、結合先のノードを最新として扱う
+	ws.sequence[historyKey{invoker, invoker.CurrentNode()}] = ws.next
+	ws.next++
+	ws.redoStack = nil
+	return nil
+}
+
+// Undo はバッファ name の直前の操作だけを取り消す
+func (ws *Workspace) Undo(name string) error {
+	buffer, err := ws.buffer(name)
+	if err != nil {
+		return err
+	}
+	return buffer.invoker.UndoLastCommand()
+}
+
+func (ws *Workspace) Redo(name string) error {
+	buffer, err := ws.buffer(name)
+	if err != nil {
+		return err
+	}
+	return buffer.invoker.RedoLastCommand()
+}
+
+func (ws *Workspace) invokers() []*CommandInvoker {
+	invokers := []*CommandInvoker{ws.macros}
+	for _, buffer := range ws.buffers {
+		invokers = append(invokers, buffer.invoker)
+	}
+	return invokers
+}
+
+// UndoAll はすべてのバッファとマクロのうち、最後に実行されていまも適用されている操作を取り消す
+func (ws *Workspace) UndoAll() error {
+	var latest *CommandInvoker
+	latestSequence := -1
+	for _, invoker := range ws.invokers() {
+		if !invoker.CanUndo() {
+			continue
+		}
+		// 閉じたバッファを変更したマクロは取り消さない
+		sequence, ok := ws.sequence[historyKey{invoker, invoker.CurrentNode()}]
+		if ok && sequence > latestSequence {
+			latest, latestSequence = invoker, sequence
+		}
+	}
+	if latest == nil {
+		return ErrNothingToUndo
+	}
+	if err := latest.UndoLastCommand(); err != nil {
+		return err
+	}
+	ws.redoStack = append(ws.redoStack, latest)
+	return nil
+}
+
+// tracked は invoker のノード node が全体の取り消し・やり直しの対象かどうかを返す
+func (ws *Workspace) tracked(invoker *CommandInvoker, node int) bool {
+	_, ok := ws.sequence[historyKey{invoker, node}]
+	return ok
+}
+
+// RedoAll は UndoAll で取り消した操作を、取り消したのと逆の順番でやり直す
+func (ws *Workspace) RedoAll() error {
+	for len(ws.redoStack) > 0 {
+		invoker := ws.redoStack[len(ws.redoStack)-1]
+		ws.redoStack = ws.redoStack[:len(ws.redoStack)-1]
+		// バッファごとの取り消し・やり直しで、やり直せなくなっているものは飛ばす
+		// 閉じたバッファを変更するマクロもやり直さない
+		if !invoker.CanRedo() || !ws.tracked(invoker, invoker.current.redo.id) {
+			continue
+		}
+		return invoker.RedoLastCommand()
+	}
+	return ErrNothingToRedo
+}
+
+// WorkspaceHistoryEntry はワークスペース全体の履歴の1件。Buffer はマクロなら "*"。
+type WorkspaceHistoryEntry struct {
+	Buffer string `json:"buffer"`
+	HistoryEntry
+}
+
+// History はすべてのバッファとマクロで適用されている操作を、実行した順に返す
+func (ws *Workspace) History() []WorkspaceHistoryEntry {
+	type sequenced struct {
+		entry    WorkspaceHistoryEntry
+		sequence int
+	}
+	all := make([]sequenced, 0)
+	collect := func(name string, invoker *CommandInvoker) {
+		for _, entry := range invoker.History() {
+			sequence, ok := ws.sequence[historyKey{invoker, entry.NodeID}]
+			if entry.Undone || !ok {
+				continue
+			}
+			all = append(all, sequenced{WorkspaceHistoryEntry{name, entry}, sequence})
+		}
+	}
+	collect(workspaceScope, ws.macros)
+	for _, buffer := range ws.buffers {
+		collect(buffer.name, buffer.invoker)
+	}
+	slices.SortFunc(all, func(a, b sequenced) int { return a.sequence - b.sequence })
+
+	entries := make([]WorkspaceHistoryEntry, 0, len(all))
+	for i, s := range all {
+		s.entry.Index = i + 1
+		entries = append(entries, s.entry)
+	}
+	return entries
+}
+
+func (ws *Workspace) Print() {
+	for _, buffer := range ws.buffers {
+		fmt.Printf("[%s] ", buffer.name)
+		buffer.editor.Print()
+	}
+}
+
+func ExecWorkspace() {
+	fmt.Println("=== Workspace Demo ===")
+
+	ws := NewWorkspace()
+	ws.Open("main.go", "func oldName() {}")
+	ws.Open("util.go", "// oldName helper")
+	ws.Open("README.md", "# oldName")
+
+	ws.Execute("main.go", func(editor *TextEditor) Command { return NewWriteCommand(editor, " // entry") })
+	ws.Execute("README.md", func(editor *TextEditor) Command { return NewWriteCommand(editor, " (draft)") })
+	ws.Print()
+
+	fmt.Println("\n--- すべてのバッファで名前を変更 ---")
+	err := ws.ExecuteAll("rename oldName -> newName", func(name string, editor *TextEditor) Command {
+		return NewReplaceCommand(editor, "oldName", "newName")
+	})
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+	ws.Execute("util.go", func(editor *TextEditor) Command { return NewWriteCommand(editor, " (v2)") })
+	ws.Print()
+
+	fmt.Println("\n--- 全体の履歴 ---")
+	for _, entry := range ws.History() {
+		fmt.Printf("%d. [%s] %s\n", entry.Index, entry.Buffer, entry.Description)
+	}
+
+	fmt.Println("\n--- README.md だけ取り消す ---")
+	if err := ws.Undo("README.md"); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	}
+	ws.Print()
+
+	fmt.Println("\n--- 全体で2回取り消す（名前の変更はまとめて戻る） ---")
+	ws.UndoAll()
+	ws.UndoAll()
+	ws.Print()
+
+	fmt.Println("\n--- 全体でやり直す ---")
+	ws.RedoAll()
+	ws.Print()
+
+	fmt.Println("\n=== Demo completed ===")
+}
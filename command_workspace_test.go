@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func writeText(text string) func(*TextEditor) Command {
+	return func(editor *TextEditor) Command { return NewWriteCommand(editor, text) }
+}
+
+// newTestWorkspace は a, b, c の3つのバッファを開いたワークスペースを返す
+func newTestWorkspace(t *testing.T) *Workspace {
+	t.Helper()
+	ws := NewWorkspace()
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := ws.Open(name, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ws
+}
+
+// contents はバッファの内容を "a=..,b=.." の形で返す
+func contents(ws *Workspace) string {
+	var parts []string
+	for _, name := range ws.Names() {
+		editor, _ := ws.Editor(name)
+		parts = append(parts, name+"="+editor.GetContent())
+	}
+	return strings.Join(parts, ",")
+}
+
+func historyDescriptions(ws *Workspace) string {
+	var parts []string
+	for _, entry := range ws.History() {
+		parts = append(parts, entry.Buffer+":"+entry.Description)
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestWorkspaceBuffers(t *testing.T) {
+	ws := newTestWorkspace(t)
+	if _, err := ws.Open("a", ""); !errors.Is(err, ErrBufferExists) {
+		t.Errorf("Open twice: error = %v, want ErrBufferExists", err)
+	}
+	for name, err := range map[string]error{
+		"Editor":  func() error { _, err := ws.Editor("x"); return err }(),
+		"Invoker": func() error { _, err := ws.Invoker("x"); return err }(),
+		"Execute": ws.Execute("x", writeText("!")),
+		"Undo":    ws.Undo("x"),
+		"Redo":    ws.Redo("x"),
+		"Close":   ws.Close("x"),
+	} {
+		if !errors.Is(err, ErrUnknownBuffer) {
+			t.Errorf("%s on an unknown buffer: error = %v, want ErrUnknownBuffer", name, err)
+		}
+	}
+	if err := ws.Close("b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ws.Names(), ","); got != "a,c" {
+		t.Errorf("Names = %s, want a,c", got)
+	}
+	// 閉じた名前でもう一度開ける
+	if _, err := ws.Open("b", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(ws); got != "a=a,c=c,b=new" {
+		t.Errorf("contents = %s", got)
+	}
+}
+
+func TestWorkspaceExecuteBuildsForTheNamedBuffer(t *testing.T) {
+	ws := newTestWorkspace(t)
+	if err := ws.Execute("b", writeText("!")); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(ws); got != "a=a,b=b!,c=c" {
+		t.Errorf("contents = %s", got)
+	}
+	if err := ws.Execute("b", func(*TextEditor) Command { return nil }); !errors.Is(err, ErrNoCommand) {
+		t.Errorf("nil command: error = %v, want ErrNoCommand", err)
+	}
+	invoker, _ := ws.Invoker("b")
+	if got := len(invoker.History()); got != 1 {
+		t.Errorf("b has %d history entries, want 1", got)
+	}
+	if err := ws.Undo("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.Redo("b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(ws); got != "a=a,b=b!,c=c" {
+		t.Errorf("contents after undo and redo = %s", got)
+	}
+}
+
+func TestWorkspaceMacro(t *testing.T) {
+	ws := newTestWorkspace(t)
+	err := ws.ExecuteMacro("append", []string{"a", "c"}, func(name string, editor *TextEditor) Command {
+		return NewWriteCommand(editor, "+"+name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(ws); got != "a=a+a,b=b,c=c+c" {
+		t.Errorf("contents = %s", got)
+	}
+
+	// 存在しないバッファを含むマクロは何もしない
+	if err := ws.ExecuteMacro("bad", []string{"a", "x"}, func(string, *TextEditor) Command { return nil }); !errors.Is(err, ErrUnknownBuffer) {
+		t.Errorf("unknown buffer: error = %v, want ErrUnknownBuffer", err)
+	}
+	// 途中で失敗したら、適用済みのバッファも元に戻す
+	err = ws.ExecuteAll("fail", func(name string, editor *TextEditor) Command {
+		if name == "c" {
+			return NewDeleteRangeCommand(editor, 0, 100)
+		}
+		return NewWriteCommand(editor, "?")
+	})
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("failing macro: error = %v, want ErrOutOfRange", err)
+	}
+	if got := contents(ws); got != "a=a+a,b=b,c=c+c" {
+		t.Errorf("contents after a failed macro = %s", got)
+	}
+	if got := historyDescriptions(ws); got != "*:Macro: append (2 commands)" {
+		t.Errorf("history = %s", got)
+	}
+}
+
+func TestWorkspaceUndoAllFollowsExecutionOrder(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ws.Execute("a", writeText("1"))
+	ws.ExecuteAll("all", func(_ string, editor *TextEditor) Command { return NewWriteCommand(editor, "2") })
+	ws.Execute("b", writeText("3"))
+	if got := historyDescriptions(ws); got != `a:Write: "1",*:Macro: all (3 commands),b:Write: "3"` {
+		t.Errorf("history = %s", got)
+	}
+
+	steps := []string{
+		"a=a12,b=b2,c=c2",
+		"a=a1,b=b,c=c",
+		"a=a,b=b,c=c",
+	}
+	for _, want := range steps {
+		if err := ws.UndoAll(); err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(ws); got != want {
+			t.Errorf("after UndoAll: %s, want %s", got, want)
+		}
+	}
+	if err := ws.UndoAll(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("UndoAll at the start: error = %v, want ErrNothingToUndo", err)
+	}
+	for i := len(steps) - 2; i >= 0; i-- {
+		if err := ws.RedoAll(); err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(ws); got != steps[i] {
+			t.Errorf("after RedoAll: %s, want %s", got, steps[i])
+		}
+	}
+	if err := ws.RedoAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.RedoAll(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("RedoAll at the end: error = %v, want ErrNothingToRedo", err)
+	}
+}
+
+func TestWorkspaceRedoAllSkipsBufferRedone(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ws.Execute("a", writeText("1"))
+	ws.Execute("b", writeText("2"))
+	ws.UndoAll()
+	ws.UndoAll()
+	// a の取り消しはバッファごとにやり直したので、RedoAll では b だけをやり直す
+	if err := ws.Redo("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.RedoAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(ws); got != "a=a1,b=b2,c=c" {
+		t.Errorf("contents = %s", got)
+	}
+	if err := ws.RedoAll(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("error = %v, want ErrNothingToRedo", err)
+	}
+}
+
+func TestWorkspaceCloseDropsMacrosOnTheBuffer(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ws.ExecuteMacro("a and b", []string{"a", "b"}, func(_ string, editor *TextEditor) Command { return NewWriteCommand(editor, "1") })
+	ws.ExecuteMacro("a and c", []string{"a", "c"}, func(_ string, editor *TextEditor) Command { return NewWriteCommand(editor, "2") })
+	ws.Execute("c", writeText("3"))
+	closed, _ := ws.Editor("b")
+
+	if err := ws.Close("b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := historyDescriptions(ws); got != `*:Macro: a and c (2 commands),c:Write: "3"` {
+		t.Errorf("history = %s", got)
+	}
+	for _, want := range []string{"a=a12,c=c2", "a=a1,c=c"} {
+		if err := ws.UndoAll(); err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(ws); got != want {
+			t.Errorf("after UndoAll: %s, want %s", got, want)
+		}
+	}
+	// 閉じたバッファを変更したマクロは取り消さない
+	if err := ws.UndoAll(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("UndoAll over the closed buffer's macro: error = %v, want ErrNothingToUndo", err)
+	}
+	if got := closed.GetContent(); got != "b1" {
+		t.Errorf("closed editor = %q, want it untouched", got)
+	}
+}
+
+func TestWorkspaceCloseStopsRedoOfMacrosOnTheBuffer(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ws.ExecuteMacro("a and b", []string{"a", "b"}, func(_ string, editor *TextEditor) Command { return NewWriteCommand(editor, "1") })
+	ws.Execute("c", writeText("2"))
+	ws.UndoAll()
+	ws.UndoAll()
+	closed, _ := ws.Editor("b")
+
+	if err := ws.Close("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.RedoAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.RedoAll(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("RedoAll of the closed buffer's macro: error = %v, want ErrNothingToRedo", err)
+	}
+	if got := contents(ws); got != "a=a,c=c2" {
+		t.Errorf("contents = %s", got)
+	}
+	if got := closed.GetContent(); got != "b" {
+		t.Errorf("closed editor = %q, want it untouched", got)
+	}
+}
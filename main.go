@@ -12,4 +12,24 @@ func main() {
 	//ExecObserver()
 	//ExecMemento()
 	ExecCommand()
+	//ExecCommandJournal()
+	//ExecUndoTree()
+	//ExecCommandCoalescing()
+	//ExecCommandMiddleware()
+	//ExecAsyncCommandInvoker()
+	//ExecCollaboration()
+	//ExecPatternReplace()
+	//ExecHistoryLimit()
+	//ExecCommandHistory()
+	//ExecWorkspace()
+	//ExecFileEditor()
+	//ExecScript()
+	//ExecREPL()
+	//ExecInteractiveREPL()
+	//ExecMacroRecording()
+	//ExecSeededMemento()
+	//ExecMementoStorage()
+	//ExecGenericMemento()
+	//ExecMementoRetention()
+	//ExecFruitRule()
 }
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"math/rand"
+	"os"
+	"slices"
 	"time"
 )
 
@@ -21,53 +24,79 @@ func (m *Memento) GetFruits() []string {
 	return fruits
 }
 
+func (m *Memento) String() string {
+	return fmt.Sprintf("[money = %d, fruits = %v]", m.money, m.fruits)
+}
+
+func (m *Memento) Clone() *Memento {
+	return &Memento{money: m.money, fruits: m.GetFruits()}
+}
+
 type Gamer struct {
 	money  int
 	fruits []string
-	rand   *rand.Rand
+	dice   DiceRoller
+	// fruitRule はメメントに残すフルーツを決める
+	fruitRule FruitRule
+	// out は Bet の結果を書き出す先
+	out io.Writer
 }
 
-func NewGamer(money int) *Gamer {
-	return &Gamer{
-		money:  money,
-		fruits: make([]string, 0),
-		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+type GamerOption func(*Gamer)
+
+// WithGamerOutput は Bet の結果を os.Stdout の代わりに w に書き出す
+func WithGamerOutput(w io.Writer) GamerOption {
+	return func(g *Gamer) {
+		g.out = w
 	}
 }
 
+// NewGamer は options で乱数を指定しなければ、現在時刻を種にしたサイコロを使う。
+// メメントに残すフルーツは、WithFruitRule で指定しなければ AppleOnly で決める。
+func NewGamer(money int, options ...GamerOption) *Gamer {
+	gamer := &Gamer{
+		money:     money,
+		fruits:    make([]string, 0),
+		fruitRule: AppleOnly,
+		out:       os.Stdout,
+	}
+	for _, option := range options {
+		option(gamer)
+	}
+	if gamer.dice == nil {
+		gamer.dice = NewRandDice(rand.NewSource(time.Now().UnixNano()))
+	}
+	return gamer
+}
+
 func (g *Gamer) GetMoney() int {
 	return g.money
 }
 
 func (g *Gamer) Bet() {
-	dice := g.rand.Intn(6) + 1 // 1-6のサイコロ
+	dice := g.dice.Roll(6) + 1 // 1-6のサイコロ
 
 	switch dice {
 	case 1:
 		g.money += 100
-		fmt.Println("所持金が増えました。")
+		fmt.Fprintln(g.out, "所持金が増えました。")
 	case 2:
 		g.money += 50
-		fmt.Println("所持金が少し増えました。")
+		fmt.Fprintln(g.out, "所持金が少し増えました。")
 	case 6:
 		fruit := g.getFruit()
-		fmt.Printf("フルーツ（%s）をもらいました。\n", fruit)
+		fmt.Fprintf(g.out, "フルーツ（%s）をもらいました。\n", fruit)
 		g.fruits = append(g.fruits, fruit)
 	default:
-		fmt.Println("何も起こりませんでした。")
+		fmt.Fprintln(g.out, "何も起こりませんでした。")
 	}
 }
 
 func (g *Gamer) CreateMemento() *Memento {
-	m := &Memento{
-		money: g.money,
+	return &Memento{
+		money:  g.money,
+		fruits: g.fruitRule(slices.Clone(g.fruits)),
 	}
-	for _, fruit := range g.fruits {
-		if fruit == "りんご" {
-			m.fruits = append(m.fruits, fruit)
-		}
-	}
-	return m
 }
 
 func (g *Gamer) RestoreMemento(memento *Memento) {
@@ -81,83 +110,141 @@ func (g *Gamer) String() string {
 
 func (g *Gamer) getFruit() string {
 	prefix := ""
-	if g.rand.Intn(2) == 0 {
+	if g.dice.Roll(2) == 0 {
 		prefix = "おいしい"
 	}
 
 	fruitTypes := []string{"りんご", "ぶどう", "ばなな", "みかん"}
-	fruit := fruitTypes[g.rand.Intn(len(fruitTypes))]
+	fruit := fruitTypes[g.dice.Roll(len(fruitTypes))]
 
 	return prefix + fruit
 }
 
-type Caretaker struct {
-	mementos []*Memento
+// Cloner は自身の深いコピーを返す。コピーは元とスライスやポインタを共有してはいけない。
+type Cloner[S any] interface {
+	Clone() S
 }
 
-func NewCaretaker() *Caretaker {
-	return &Caretaker{
-		mementos: make([]*Memento, 0),
-	}
+// Originator は状態 S をメメントとして書き出し、メメントから状態を戻せる型
+type Originator[S any] interface {
+	CreateMemento() S
+	RestoreMemento(memento S)
 }
 
-func (c *Caretaker) AddMemento(memento *Memento) {
-	c.mementos = append(c.mementos, memento)
-	fmt.Printf("メメントを保存しました。（保存数: %d）\n", len(c.mementos))
+// Caretaker はメメントを保存する。保存するとき・取り出すときに Clone するので、
+// 保存したメメントが呼び出し側やオリジネーターの状態と共有されることはない。
+type Caretaker[S Cloner[S]] struct {
+	entries []caretakerEntry[S]
+	// policies が1つでもあれば、保存するたびにどのポリシーにも残されないメメントを削除する
+	policies  []RetentionPolicy[S]
+	now       func() time.Time
+	lastPrune PruneReport[S]
+	// out は保存・削除の経過を書き出す先
+	out io.Writer
 }
 
-func (c *Caretaker) GetMemento(index int) *Memento {
-	if index >= 0 && index < len(c.mementos) {
-		return c.mementos[index]
+type caretakerEntry[S any] struct {
+	memento S
+	savedAt time.Time
+	// pin が空でなければ、保持ポリシーに関係なく削除しない
+	pin string
+}
+
+type CaretakerOption[S Cloner[S]] func(*Caretaker[S])
+
+func NewCaretaker[S Cloner[S]](options ...CaretakerOption[S]) *Caretaker[S] {
+	caretaker := &Caretaker[S]{
+		entries: make([]caretakerEntry[S], 0),
+		now:     time.Now,
+		out:     os.Stdout,
 	}
-	return nil
+	for _, option := range options {
+		option(caretaker)
+	}
+	return caretaker
 }
 
-func (c *Caretaker) GetLatestMemento() *Memento {
-	if len(c.mementos) > 0 {
-		return c.mementos[len(c.mementos)-1]
+// WithCaretakerOutput は保存・削除の経過を os.Stdout の代わりに w に書き出す
+func WithCaretakerOutput[S Cloner[S]](w io.Writer) CaretakerOption[S] {
+	return func(c *Caretaker[S]) {
+		c.out = w
 	}
-	return nil
 }
 
-func (c *Caretaker) GetMementoCount() int {
-	return len(c.mementos)
+func (c *Caretaker[S]) AddMemento(memento S) {
+	c.entries = append(c.entries, caretakerEntry[S]{memento: memento.Clone(), savedAt: c.now()})
+	fmt.Fprintf(c.out, "メメントを保存しました。（保存数: %d）\n", len(c.entries))
+	if c.lastPrune = c.Prune(); len(c.lastPrune.Pruned) > 0 {
+		fmt.Fprintf(c.out, "古いメメントを%d件削除しました。（保存数: %d）\n", len(c.lastPrune.Pruned), len(c.entries))
+	}
 }
 
-func ExecMemento() {
-	fmt.Println("=== Memento Pattern Demo ===")
+// Save は originator の現在の状態を保存する
+func (c *Caretaker[S]) Save(originator Originator[S]) {
+	c.AddMemento(originator.CreateMemento())
+}
 
-	gamer := NewGamer(100)
-	fmt.Printf("初期状態: %s\n", gamer.String())
+// Restore は index 番目のメメントに originator を戻す。index が範囲外なら false を返す。
+func (c *Caretaker[S]) Restore(originator Originator[S], index int) bool {
+	if index < 0 || index >= len(c.entries) {
+		return false
+	}
+	originator.RestoreMemento(c.entries[index].memento.Clone())
+	return true
+}
 
-	caretaker := NewCaretaker()
+// GetMemento は index 番目のメメントのコピーを返す。範囲外ならゼロ値を返す。
+func (c *Caretaker[S]) GetMemento(index int) S {
+	if index >= 0 && index < len(c.entries) {
+		return c.entries[index].memento.Clone()
+	}
+	var zero S
+	return zero
+}
 
-	caretaker.AddMemento(gamer.CreateMemento())
+func (c *Caretaker[S]) GetLatestMemento() S {
+	return c.GetMemento(len(c.entries) - 1)
+}
 
-	fmt.Println("\n--- ゲーム開始 ---")
+func (c *Caretaker[S]) GetMementoCount() int {
+	return len(c.entries)
+}
 
-	for i := 0; i < 100; i++ {
-		fmt.Printf("\n==== %d回目 ====\n", i+1)
-		fmt.Printf("現在の状態: %s\n", gamer.String())
+// playMementoGame は gamer で rounds 回遊ぶ。所持金が増えたら状態を保存し、減ったら最後に保存した状態に戻す。
+// 各回の経過と保存の記録を out に書き出し、メメントを保存した Caretaker を返す。
+func playMementoGame(gamer *Gamer, rounds int, out io.Writer) *Caretaker[*Memento] {
+	caretaker := NewCaretaker(WithCaretakerOutput[*Memento](out))
+	caretaker.AddMemento(gamer.CreateMemento())
+	for i := 0; i < rounds; i++ {
+		fmt.Fprintf(out, "\n==== %d回目 ====\n", i+1)
+		fmt.Fprintf(out, "現在の状態: %s\n", gamer.String())
 
 		gamer.Bet()
 
-		fmt.Printf("所持金は%d円になりました。\n", gamer.GetMoney())
+		fmt.Fprintf(out, "所持金は%d円になりました。\n", gamer.GetMoney())
 
 		if gamer.GetMoney() > 100 {
-			fmt.Println("（だいぶ増えたので、現在の状態を保存しておこう）")
+			fmt.Fprintln(out, "（だいぶ増えたので、現在の状態を保存しておこう）")
 			caretaker.AddMemento(gamer.CreateMemento())
 		} else if gamer.GetMoney() < 100 {
-			fmt.Println("（だいぶ減ったので、以前の状態に復帰しよう）")
-			latestMemento := caretaker.GetLatestMemento()
-			if latestMemento != nil {
-				gamer.RestoreMemento(latestMemento)
-				fmt.Printf("復帰後の状態: %s\n", gamer.String())
+			fmt.Fprintln(out, "（だいぶ減ったので、以前の状態に復帰しよう）")
+			if latest := caretaker.GetLatestMemento(); latest != nil {
+				gamer.RestoreMemento(latest)
+				fmt.Fprintf(out, "復帰後の状態: %s\n", gamer.String())
 			}
 		}
-
-		time.Sleep(100 * time.Millisecond)
 	}
+	return caretaker
+}
+
+func ExecMemento() {
+	fmt.Println("=== Memento Pattern Demo ===")
+
+	gamer := NewGamer(100)
+	fmt.Printf("初期状態: %s\n", gamer.String())
+
+	fmt.Println("\n--- ゲーム開始 ---")
+	caretaker := playMementoGame(gamer, 100, os.Stdout)
 
 	fmt.Println("\n--- ゲーム終了 ---")
 	fmt.Printf("最終状態: %s\n", gamer.String())
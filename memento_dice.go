@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"slices"
+)
+
+var ErrDiceReplay = errors.New("dice replay does not match")
+
+// DiceRoller は Gamer が使う乱数。Roll は 0 以上 sides 未満の値を返す。
+type DiceRoller interface {
+	Roll(sides int) int
+}
+
+type randDice struct {
+	rand *rand.Rand
+}
+
+func NewRandDice(source rand.Source) DiceRoller {
+	return &randDice{rand: rand.New(source)}
+}
+
+func (d *randDice) Roll(sides int) int {
+	return d.rand.Intn(sides)
+}
+
+// WithSeed は seed から作ったサイコロを使う。同じ seed なら同じ結果になる。
+func WithSeed(seed int64) GamerOption {
+	return WithRandSource(rand.NewSource(seed))
+}
+
+func WithRandSource(source rand.Source) GamerOption {
+	return WithDice(NewRandDice(source))
+}
+
+// WithDice は DiceRecorder や DiceReplayer など、任意のサイコロを使う
+func WithDice(dice DiceRoller) GamerOption {
+	return func(g *Gamer) {
+		g.dice = dice
+	}
+}
+
+// DiceRoll は1回分のサイコロの目
+type DiceRoll struct {
+	Sides int `json:"sides"`
+	Value int `json:"value"`
+}
+
+// DiceRecorder は dice の出目をすべて記録する
+type DiceRecorder struct {
+	dice  DiceRoller
+	rolls []DiceRoll
+}
+
+func NewDiceRecorder(dice DiceRoller) *DiceRecorder {
+	return &DiceRecorder{dice: dice}
+}
+
+func (r *DiceRecorder) Roll(sides int) int {
+	value := r.dice.Roll(sides)
+	r.rolls = append(r.rolls, DiceRoll{Sides: sides, Value: value})
+	return value
+}
+
+// Rolls はこれまでの出目を振った順に返す
+func (r *DiceRecorder) Rolls() []DiceRoll {
+	return slices.Clone(r.rolls)
+}
+
+// DiceReplayer は記録した出目を同じ順番で返す。
+// 出目が尽きたり、面の数が記録と違ったりしたときは 0 を返し、最初の食い違いを Err で返す。
+type DiceReplayer struct {
+	rolls []DiceRoll
+	next  int
+	err   error
+}
+
+func NewDiceReplayer(rolls []DiceRoll) *DiceReplayer {
+	return &DiceReplayer{rolls: slices.Clone(rolls)}
+}
+
+func (r *DiceReplayer) Roll(sides int) int {
+	if r.next >= len(r.rolls) {
+		r.fail(fmt.Errorf("%w: roll %d requested, only %d recorded", ErrDiceReplay, r.next+1, len(r.rolls)))
+		return 0
+	}
+	roll := r.rolls[r.next]
+	r.next++
+	if roll.Sides != sides || roll.Value < 0 || roll.Value >= sides {
+		r.fail(fmt.Errorf("%w: roll %d is %d of %d, want %d sides", ErrDiceReplay, r.next, roll.Value, roll.Sides, sides))
+		return 0
+	}
+	return roll.Value
+}
+
+func (r *DiceReplayer) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Remaining はまだ使っていない出目の数を返す
+func (r *DiceReplayer) Remaining() int {
+	return len(r.rolls) - r.next
+}
+
+func (r *DiceReplayer) Err() error {
+	return r.err
+}
+
+// sameMementos は2つの Caretaker が同じ所持金・フルーツのメメントを同じ順に持っているかどうかを返す
+func sameMementos(a, b *Caretaker[*Memento]) bool {
+	if a.GetMementoCount() != b.GetMementoCount() {
+		return false
+	}
+	for i := 0; i < a.GetMementoCount(); i++ {
+		x, y := a.GetMemento(i), b.GetMemento(i)
+		if x.GetMoney() != y.GetMoney() || !slices.Equal(x.GetFruits(), y.GetFruits()) {
+			return false
+		}
+	}
+	return true
+}
+
+func ExecSeededMemento() {
+	fmt.Println("=== Seeded Memento Demo ===")
+
+	// 結果だけを比べるので、各回の経過は表示しない
+	quiet := WithGamerOutput(io.Discard)
+
+	fmt.Println("\n--- 同じ種で2回遊ぶ ---")
+	first := NewGamer(100, WithSeed(42), quiet)
+	firstHistory := playMementoGame(first, 5, io.Discard)
+	second := NewGamer(100, WithSeed(42), quiet)
+	secondHistory := playMementoGame(second, 5, io.Discard)
+	fmt.Printf("1回目: %s\n2回目: %s\n", first, second)
+	fmt.Printf("メメントの履歴が一致: %v\n", sameMementos(firstHistory, secondHistory))
+
+	fmt.Println("\n--- 出目を記録して再生する ---")
+	recorder := NewDiceRecorder(NewRandDice(rand.NewSource(7)))
+	recorded := NewGamer(100, WithDice(recorder), quiet)
+	recordedHistory := playMementoGame(recorded, 5, io.Discard)
+	fmt.Printf("出目: %v\n", recorder.Rolls())
+
+	replayer := NewDiceReplayer(recorder.Rolls())
+	replayed := NewGamer(100, WithDice(replayer), quiet)
+	replayedHistory := playMementoGame(replayed, 5, io.Discard)
+	fmt.Printf("記録: %s\n再生: %s\n", recorded, replayed)
+	fmt.Printf("メメントの履歴が一致: %v\n", sameMementos(recordedHistory, replayedHistory))
+	fmt.Printf("残りの出目: %d, エラー: %v\n", replayer.Remaining(), replayer.Err())
+
+	fmt.Println("\n--- 記録より多く遊ぶと食い違いを報告する ---")
+	short := NewDiceReplayer(recorder.Rolls())
+	playMementoGame(NewGamer(100, WithDice(short), quiet), 6, io.Discard)
+	fmt.Printf("エラー: %v\n", short.Err())
+
+	fmt.Println("\n=== Demo completed ===")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// quietGamer と quietCaretaker は、テスト中に Bet の結果やメメントの保存を表示しない
+var (
+	quietGamer     = WithGamerOutput(io.Discard)
+	quietCaretaker = WithCaretakerOutput[*Memento](io.Discard)
+)
+
+func TestGamerFollowsDice(t *testing.T) {
+	replayer := NewDiceReplayer([]DiceRoll{
+		{Sides: 6, Value: 0}, // +100
+		{Sides: 6, Value: 5}, // フルーツ
+		{Sides: 2, Value: 1},
+		{Sides: 4, Value: 0}, // りんご
+		{Sides: 6, Value: 1}, // +50
+		{Sides: 6, Value: 5}, // フルーツ
+		{Sides: 2, Value: 0}, // おいしい
+		{Sides: 4, Value: 3}, // みかん
+		{Sides: 6, Value: 3}, // 何も起こらない
+	})
+	gamer := NewGamer(100, WithDice(replayer), quietGamer)
+	for i := 0; i < 4; i++ {
+		gamer.Bet()
+	}
+	if err := replayer.Err(); err != nil || replayer.Remaining() != 1 {
+		t.Fatalf("replayer: err %v, %d remaining", err, replayer.Remaining())
+	}
+	gamer.Bet()
+	if got, want := gamer.String(), "[money = 250, fruits = [りんご おいしいみかん]]"; got != want {
+		t.Errorf("gamer = %s, want %s", got, want)
+	}
+	// メメントには AppleOnly でりんごだけが残る
+	if got := gamer.CreateMemento().GetFruits(); !slices.Equal(got, []string{"りんご"}) {
+		t.Errorf("memento fruits = %v", got)
+	}
+}
+
+// savedMementos は mementos を固定した日時で保存したバイト列を返す
+func savedMementos(t *testing.T, mementos *Caretaker[*Memento]) []byte {
+	t.Helper()
+	caretaker := NewCaretaker(quietCaretaker, WithCaretakerClock[*Memento](func() time.Time { return time.Unix(0, 0) }))
+	for i := 0; i < mementos.GetMementoCount(); i++ {
+		caretaker.AddMemento(mementos.GetMemento(i))
+	}
+	var buf bytes.Buffer
+	if err := SaveCaretaker(&buf, caretaker, MementoBinary, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 同じ種なら、出目もメメントの履歴も保存したファイルも完全に一致する
+func TestSeededGameIsReproducible(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		firstDice := NewDiceRecorder(NewRandDice(rand.NewSource(seed)))
+		first := NewGamer(100, WithDice(firstDice), quietGamer)
+		firstHistory := playMementoGame(first, 50, io.Discard)
+		secondDice := NewDiceRecorder(NewRandDice(rand.NewSource(seed)))
+		second := NewGamer(100, WithDice(secondDice), quietGamer)
+		secondHistory := playMementoGame(second, 50, io.Discard)
+
+		if !slices.Equal(firstDice.Rolls(), secondDice.Rolls()) {
+			t.Fatalf("seed %d: rolls differ", seed)
+		}
+		if first.String() != second.String() || !sameMementos(firstHistory, secondHistory) {
+			t.Fatalf("seed %d: %s and %s differ", seed, first, second)
+		}
+		if !bytes.Equal(savedMementos(t, firstHistory), savedMementos(t, secondHistory)) {
+			t.Errorf("seed %d: saved mementos differ", seed)
+		}
+
+		withSeed := NewGamer(100, WithSeed(seed), quietGamer)
+		playMementoGame(withSeed, 50, io.Discard)
+		if withSeed.String() != first.String() {
+			t.Errorf("seed %d: WithSeed gives %s, want %s", seed, withSeed, first)
+		}
+	}
+}
+
+func TestDiceReplayReproducesGame(t *testing.T) {
+	recorder := NewDiceRecorder(NewRandDice(rand.NewSource(7)))
+	recorded := NewGamer(100, WithDice(recorder), quietGamer)
+	recordedHistory := playMementoGame(recorded, 30, io.Discard)
+
+	replayer := NewDiceReplayer(recorder.Rolls())
+	replayed := NewGamer(100, WithDice(replayer), quietGamer)
+	replayedHistory := playMementoGame(replayed, 30, io.Discard)
+	if err := replayer.Err(); err != nil || replayer.Remaining() != 0 {
+		t.Fatalf("replayer: err %v, %d remaining", err, replayer.Remaining())
+	}
+	if replayed.String() != recorded.String() {
+		t.Errorf("replayed %s, recorded %s", replayed, recorded)
+	}
+	if !bytes.Equal(savedMementos(t, recordedHistory), savedMementos(t, replayedHistory)) {
+		t.Error("saved mementos differ")
+	}
+
+	short := NewDiceReplayer(recorder.Rolls())
+	playMementoGame(NewGamer(100, WithDice(short), quietGamer), 31, io.Discard)
+	if err := short.Err(); !errors.Is(err, ErrDiceReplay) {
+		t.Errorf("playing past the recording: error = %v, want ErrDiceReplay", err)
+	}
+
+	mismatched := NewDiceReplayer([]DiceRoll{{Sides: 4, Value: 1}})
+	if got := mismatched.Roll(6); got != 0 || !errors.Is(mismatched.Err(), ErrDiceReplay) {
+		t.Errorf("Roll(6) over a 4-sided record = %d, error %v", got, mismatched.Err())
+	}
+}
+
+// 遊んだ経過は渡した書き出し先にだけ出る
+func TestPlayMementoGameWritesToOut(t *testing.T) {
+	replayer := NewDiceReplayer([]DiceRoll{
+		{Sides: 6, Value: 0}, // +100
+		{Sides: 6, Value: 3}, // 何も起こらない
+	})
+	var bets, out bytes.Buffer
+	gamer := NewGamer(100, WithDice(replayer), WithGamerOutput(&bets))
+	caretaker := playMementoGame(gamer, 2, &out)
+
+	if got := caretaker.GetMementoCount(); got != 3 {
+		t.Errorf("%d mementos, want the initial state and two saves", got)
+	}
+	if got, want := bets.String(), "所持金が増えました。\n何も起こりませんでした。\n"; got != want {
+		t.Errorf("gamer output = %q, want %q", got, want)
+	}
+	for _, want := range []string{"==== 2回目 ====", "所持金は200円になりました。", "メメントを保存しました。（保存数: 3）"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// FruitRule は持っているフルーツのうち、メメントに残すものを返す。
+// fruits は Gamer のフルーツのコピーなので、書き換えてそのまま返してもよい。
+type FruitRule func(fruits []string) []string
+
+// WithFruitRule はメメントに残すフルーツを rule で決める
+func WithFruitRule(rule FruitRule) GamerOption {
+	return func(g *Gamer) {
+		g.fruitRule = rule
+	}
+}
+
+// AppleOnly は "りんご" だけを残す。NewGamer の既定のルール。
+func AppleOnly(fruits []string) []string {
+	return KeepFruitsIf(func(fruit string) bool {
+		return fruit == "りんご"
+	})(fruits)
+}
+
+// KeepAllFruits はすべてのフルーツを残す
+func KeepAllFruits(fruits []string) []string {
+	return fruits
+}
+
+// KeepFruitsIf は keep が true を返すフルーツを残す
+func KeepFruitsIf(keep func(fruit string) bool) FruitRule {
+	return func(fruits []string) []string {
+		return slices.DeleteFunc(fruits, func(fruit string) bool {
+			return !keep(fruit)
+		})
+	}
+}
+
+// KeepFruitsWorth は score が min 以上のフルーツを残す
+func KeepFruitsWorth(score func(fruit string) int, min int) FruitRule {
+	return KeepFruitsIf(func(fruit string) bool {
+		return score(fruit) >= min
+	})
+}
+
+// KeepTopFruits は score の高いものから k 個を残す。同じ点数なら先にもらったものを優先し、残すフルーツはもらった順に並べる。
+func KeepTopFruits(score func(fruit string) int, k int) FruitRule {
+	return func(fruits []string) []string {
+		if len(fruits) <= k {
+			return fruits
+		}
+		order := make([]int, len(fruits))
+		for i := range order {
+			order[i] = i
+		}
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmp.Compare(score(fruits[b]), score(fruits[a]))
+		})
+		top := order[:max(k, 0)]
+		slices.Sort(top)
+		kept := make([]string, 0, len(top))
+		for _, i := range top {
+			kept = append(kept, fruits[i])
+		}
+		return kept
+	}
+}
+
+var fruitValues = map[string]int{"りんご": 100, "ぶどう": 80, "ばなな": 50, "みかん": 30}
+
+// FruitValue はフルーツの価値を返す。"おいしい" ものは2倍になる。
+func FruitValue(fruit string) int {
+	if name, ok := strings.CutPrefix(fruit, "おいしい"); ok {
+		return fruitValues[name] * 2
+	}
+	return fruitValues[fruit]
+}
+
+func ExecFruitRule() {
+	fmt.Println("=== Fruit Rule Demo ===")
+
+	fruits := []string{"りんご", "おいしいりんご", "ぶどう", "みかん", "おいしいばなな", "おいしいみかん"}
+	rules := []struct {
+		name string
+		rule FruitRule
+	}{
+		{"AppleOnly", AppleOnly},
+		{"KeepAllFruits", KeepAllFruits},
+		{"りんごを含む", KeepFruitsIf(func(fruit string) bool { return strings.Contains(fruit, "りんご") })},
+		{"価値が80以上", KeepFruitsWorth(FruitValue, 80)},
+		{"価値の高い3つ", KeepTopFruits(FruitValue, 3)},
+	}
+
+	fmt.Printf("持っているフルーツ: %v\n", fruits)
+	for _, r := range rules {
+		gamer := NewGamer(100, WithSeed(1), WithFruitRule(r.rule))
+		gamer.fruits = slices.Clone(fruits)
+		memento := gamer.CreateMemento()
+		fmt.Printf("%s: %v\n", r.name, memento.GetFruits())
+	}
+
+	fmt.Println("\n--- 遊びながら保存する ---")
+	gamer := NewGamer(100, WithSeed(1), WithFruitRule(KeepTopFruits(FruitValue, 2)))
+	caretaker := playMementoGame(gamer, 10, os.Stdout)
+	fmt.Printf("最終状態: %s\n", gamer)
+	fmt.Printf("最新のメメント: %v\n", caretaker.GetLatestMemento())
+
+	fmt.Println("\n=== Demo completed ===")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFruitValue(t *testing.T) {
+	tests := []struct {
+		fruit string
+		want  int
+	}{
+		{"りんご", 100},
+		{"ぶどう", 80},
+		{"ばなな", 50},
+		{"みかん", 30},
+		{"おいしいりんご", 200},
+		{"おいしいみかん", 60},
+		{"おいしいおいしいりんご", 0},
+		{"いちご", 0},
+		{"おいしい", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := FruitValue(tt.fruit); got != tt.want {
+			t.Errorf("FruitValue(%q) = %d, want %d", tt.fruit, got, tt.want)
+		}
+	}
+}
+
+func TestFruitRules(t *testing.T) {
+	fruits := []string{"りんご", "おいしいりんご", "ぶどう", "みかん", "おいしいばなな", "おいしいみかん"}
+	tests := []struct {
+		name   string
+		rule   FruitRule
+		fruits []string
+		want   []string
+	}{
+		{"AppleOnly", AppleOnly, fruits, []string{"りんご"}},
+		{"KeepAllFruits", KeepAllFruits, fruits, fruits},
+		{"KeepFruitsIf prefix", KeepFruitsIf(func(fruit string) bool { return strings.HasPrefix(fruit, "おいしい") }), fruits,
+			[]string{"おいしいりんご", "おいしいばなな", "おいしいみかん"}},
+		{"KeepFruitsIf none", KeepFruitsIf(func(string) bool { return false }), fruits, []string{}},
+		{"KeepFruitsIf empty", KeepFruitsIf(func(string) bool { return true }), []string{}, []string{}},
+		{"KeepFruitsWorth 80", KeepFruitsWorth(FruitValue, 80), fruits, []string{"りんご", "おいしいりんご", "ぶどう", "おいしいばなな"}},
+		// 境界の値も残す
+		{"KeepFruitsWorth boundary", KeepFruitsWorth(FruitValue, 100), fruits, []string{"りんご", "おいしいりんご", "おいしいばなな"}},
+		{"KeepFruitsWorth above all", KeepFruitsWorth(FruitValue, 1000), fruits, []string{}},
+		{"KeepTopFruits 3", KeepTopFruits(FruitValue, 3), fruits, []string{"りんご", "おいしいりんご", "おいしいばなな"}},
+		{"KeepTopFruits 1", KeepTopFruits(FruitValue, 1), fruits, []string{"おいしいりんご"}},
+		{"KeepTopFruits 0", KeepTopFruits(FruitValue, 0), fruits, []string{}},
+		{"KeepTopFruits negative", KeepTopFruits(FruitValue, -1), fruits, []string{}},
+		{"KeepTopFruits more than held", KeepTopFruits(FruitValue, 10), fruits, fruits},
+		// 同じ点数なら先にもらったものを残し、残したものはもらった順に並べる
+		{"KeepTopFruits ties keep the earlier", KeepTopFruits(FruitValue, 2),
+			[]string{"みかん", "りんご", "おいしいばなな", "りんご"}, []string{"りんご", "おいしいばなな"}},
+		{"KeepTopFruits all tied", KeepTopFruits(FruitValue, 2),
+			[]string{"ぶどう", "ぶどう", "ぶどう"}, []string{"ぶどう", "ぶどう"}},
+		{"KeepTopFruits tie at the cut", KeepTopFruits(FruitValue, 2),
+			[]string{"みかん", "りんご", "ばなな", "おいしいばなな"}, []string{"りんご", "おいしいばなな"}},
+		{"KeepTopFruits ties in order", KeepTopFruits(func(string) int { return 1 }, 3),
+			[]string{"d", "c", "b", "a"}, []string{"d", "c", "b"}},
+	}
+	for _, tt := range tests {
+		// ルールにはコピーを渡す（Gamer と同じ）
+		if got := tt.rule(slices.Clone(tt.fruits)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// KeepTopFruits は渡されたスライスの並びを変えない
+func TestKeepTopFruitsKeepsInput(t *testing.T) {
+	fruits := []string{"みかん", "りんご", "ばなな", "ぶどう"}
+	input := slices.Clone(fruits)
+	KeepTopFruits(FruitValue, 2)(input)
+	if !slices.Equal(input, fruits) {
+		t.Errorf("input = %v, want %v", input, fruits)
+	}
+}
+
+// メメントには選んだフルーツだけが残り、Gamer のフルーツは変わらない
+func TestFruitRuleAppliesToMemento(t *testing.T) {
+	gamer := NewGamer(100, quietGamer, WithFruitRule(KeepTopFruits(FruitValue, 1)))
+	gamer.fruits = []string{"みかん", "おいしいぶどう", "りんご"}
+	memento := gamer.CreateMemento()
+	if got := memento.GetFruits(); !slices.Equal(got, []string{"おいしいぶどう"}) {
+		t.Errorf("memento fruits = %v", got)
+	}
+	if !slices.Equal(gamer.fruits, []string{"みかん", "おいしいぶどう", "りんご"}) {
+		t.Errorf("gamer fruits = %v, want them unchanged", gamer.fruits)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// EditorMemento は TextEditor の内容とカーソル・選択範囲
+type EditorMemento struct {
+	content string
+	cursor  cursorState
+}
+
+func (m *EditorMemento) GetContent() string {
+	return m.content
+}
+
+func (m *EditorMemento) Clone() *EditorMemento {
+	clone := *m
+	return &clone
+}
+
+func (te *TextEditor) CreateMemento() *EditorMemento {
+	return &EditorMemento{content: te.text.String(), cursor: te.cursorState()}
+}
+
+// RestoreMemento は内容を memento に置き換える。置き換えは編集1回として記録するので、
+// RestorePreviousContent で戻せる。
+func (te *TextEditor) RestoreMemento(memento *EditorMemento) {
+	if te.text.String() != memento.content {
+		te.SetContent(memento.content)
+	}
+	te.setCursorState(memento.cursor)
+}
+
+// DirectoryMemento は Directory の中身をまるごとコピーしたもの
+type DirectoryMemento struct {
+	entries []Entry
+}
+
+// Size は保存した時点のディレクトリのサイズを返す
+func (m *DirectoryMemento) Size() int64 {
+	var total int64
+	for _, entry := range m.entries {
+		total += entry.Size()
+	}
+	return total
+}
+
+func (m *DirectoryMemento) Clone() *DirectoryMemento {
+	return &DirectoryMemento{entries: cloneEntries(m.entries)}
+}
+
+func (d *Directory) CreateMemento() *DirectoryMemento {
+	return &DirectoryMemento{entries: cloneEntries(d.entries)}
+}
+
+// RestoreMemento は中身を memento のコピーに置き換える。
+// サブディレクトリも新しく作り直すので、以前に取得したサブディレクトリを変更しても d には反映されない。
+func (d *Directory) RestoreMemento(memento *DirectoryMemento) {
+	d.entries = cloneEntries(memento.entries)
+}
+
+// cloneEntries は File と Directory を再帰的にコピーする。それ以外の Entry はそのまま共有する。
+func cloneEntries(entries []Entry) []Entry {
+	clone := slices.Clone(entries)
+	for i, entry := range clone {
+		switch e := entry.(type) {
+		case *File:
+			clone[i] = &File{name: e.name, size: e.size}
+		case *Directory:
+			clone[i] = &Directory{name: e.name, entries: cloneEntries(e.entries)}
+		}
+	}
+	return clone
+}
+
+var (
+	_ Originator[*Memento]          = (*Gamer)(nil)
+	_ Originator[*EditorMemento]    = (*TextEditor)(nil)
+	_ Originator[*DirectoryMemento] = (*Directory)(nil)
+)
+
+func ExecGenericMemento() {
+	fmt.Println("=== Generic Memento Demo ===")
+
+	fmt.Println("\n--- Gamer ---")
+	gamer := NewGamer(100, WithSeed(3))
+	gamers := NewCaretaker[*Memento]()
+	gamers.Save(gamer)
+	for i := 0; i < 3; i++ {
+		gamer.Bet()
+	}
+	fmt.Printf("遊んだ後: %s\n", gamer)
+	gamers.Restore(gamer, 0)
+	fmt.Printf("復帰後: %s\n", gamer)
+
+	fmt.Println("\n--- TextEditor ---")
+	editor := NewTextEditor()
+	editors := NewCaretaker[*EditorMemento]()
+	editor.AppendText("Hello World")
+	editor.Select(6, 11)
+	editors.Save(editor)
+	editor.ReplaceSelection("Go")
+	editor.AppendText("!")
+	editor.Print()
+	editors.Restore(editor, 0)
+	editor.Print()
+	fmt.Printf("選択中: %q\n", editor.SelectedText())
+	editor.RestorePreviousContent()
+	fmt.Print("復元を取り消し: ")
+	editor.Print()
+
+	fmt.Println("\n--- Directory ---")
+	root := NewDirectory("root")
+	bin := NewDirectory("bin")
+	root.Add(bin)
+	bin.Add(NewFile("vi", 10000))
+	directories := NewCaretaker[*DirectoryMemento]()
+	directories.Save(root)
+
+	// 保存後にサブディレクトリを変更しても、メメントには影響しない
+	bin.Add(NewFile("latex", 20000))
+	root.Add(NewFile("memo.txt", 3000))
+	root.PrintList("")
+	fmt.Printf("サイズ: %d, 保存したサイズ: %d\n", root.Size(), directories.GetLatestMemento().Size())
+
+	directories.Restore(root, 0)
+	fmt.Println("復帰後:")
+	root.PrintList("")
+	fmt.Printf("サイズ: %d\n", root.Size())
+
+	fmt.Println("\n=== Demo completed ===")
+}
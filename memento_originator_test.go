@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// describeEntries は entries を "名前(サイズ)" の入れ子で表す
+func describeEntries(entries []Entry) string {
+	parts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if dir, ok := entry.(*Directory); ok {
+			parts = append(parts, fmt.Sprintf("%s[%s]", dir.name, describeEntries(dir.entries)))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s(%d)", entry.Name(), entry.Size()))
+	}
+	return strings.Join(parts, " ")
+}
+
+// sharedEntry は File でも Directory でもない Entry
+type sharedEntry struct{ size int64 }
+
+func (e *sharedEntry) Name() string     { return "shared" }
+func (e *sharedEntry) Size() int64      { return e.size }
+func (e *sharedEntry) PrintList(string) {}
+
+func TestEditorMementoIsIndependentOfEditor(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(editor *TextEditor)
+	}{
+		{"append", func(editor *TextEditor) { editor.AppendText("!") }},
+		{"replace selection", func(editor *TextEditor) { editor.ReplaceSelection("Go") }},
+		{"move cursor", func(editor *TextEditor) { editor.MoveCursor(0) }},
+		{"set content", func(editor *TextEditor) { editor.SetContent("other") }},
+		{"command", func(editor *TextEditor) { NewReplaceCommand(editor, "World", "Gopher").Execute() }},
+	}
+	for _, tt := range tests {
+		editor := NewTextEditor()
+		editor.SetContent("Hello World")
+		editor.Select(6, 11)
+		memento := editor.CreateMemento()
+		clone := memento.Clone()
+
+		tt.mutate(editor)
+		if memento.GetContent() != "Hello World" || memento.cursor != (cursorState{anchor: 6, cursor: 11}) {
+			t.Errorf("%s: memento = %q %+v, want it unchanged", tt.name, memento.GetContent(), memento.cursor)
+		}
+
+		editor.RestoreMemento(clone)
+		if editor.GetContent() != "Hello World" || editor.SelectedText() != "World" {
+			t.Errorf("%s: restored %q with %q selected", tt.name, editor.GetContent(), editor.SelectedText())
+		}
+		// 戻した後の編集もメメントには影響しない
+		editor.AppendText("?")
+		if clone.GetContent() != "Hello World" {
+			t.Errorf("%s: clone = %q after editing the restored editor", tt.name, clone.GetContent())
+		}
+	}
+}
+
+func TestDirectoryMementoIsIndependentOfDirectory(t *testing.T) {
+	vi := NewFile("vi", 100)
+	bin := NewDirectory("bin")
+	bin.Add(vi)
+	root := NewDirectory("root")
+	root.Add(bin)
+	root.Add(NewFile("memo", 10))
+	const want = "bin[vi(100)] memo(10)"
+
+	memento := root.CreateMemento()
+	tests := []struct {
+		name   string
+		mutate func()
+	}{
+		{"add to root", func() { root.Add(NewFile("tmp", 1)) }},
+		{"add to subdirectory", func() { bin.Add(NewFile("latex", 200)) }},
+		{"resize file", func() { vi.size = 999 }},
+		{"rename subdirectory", func() { bin.name = "sbin" }},
+		{"overwrite entry", func() { root.entries[1] = NewFile("other", 5) }},
+	}
+	for _, tt := range tests {
+		tt.mutate()
+		if got := describeEntries(memento.entries); got != want {
+			t.Errorf("after %s: memento = %s, want %s", tt.name, got, want)
+		}
+	}
+	if got := memento.Size(); got != 110 {
+		t.Errorf("memento size = %d, want 110", got)
+	}
+
+	// 戻したディレクトリは新しく作り直すので、元のサブディレクトリやメメントとは共有しない
+	root.RestoreMemento(memento)
+	bin.Add(NewFile("after", 1))
+	root.entries[0].(*Directory).Add(NewFile("restored", 1))
+	if got := describeEntries(memento.entries); got != want {
+		t.Errorf("after editing the restored directory: memento = %s", got)
+	}
+	if got := describeEntries(root.entries); got != "bin[vi(100) restored(1)] memo(10)" {
+		t.Errorf("restored root = %s", got)
+	}
+}
+
+func TestCloneEntries(t *testing.T) {
+	shared := &sharedEntry{size: 7}
+	inner := NewDirectory("inner")
+	inner.Add(NewFile("a", 1))
+	outer := NewDirectory("outer")
+	outer.Add(inner)
+	outer.Add(shared)
+	empty := NewDirectory("empty")
+	entries := []Entry{outer, empty, NewFile("b", 2)}
+
+	clone := cloneEntries(entries)
+	if got, want := describeEntries(clone), describeEntries(entries); got != want {
+		t.Fatalf("clone = %s, want %s", got, want)
+	}
+	for i := range entries {
+		if clone[i] == entries[i] {
+			t.Errorf("entry %d is shared with the original", i)
+		}
+	}
+	if clone[0].(*Directory).entries[1] != Entry(shared) {
+		t.Error("an unknown Entry type should be shared as is")
+	}
+
+	inner.entries[0].(*File).size = 100
+	inner.Add(NewFile("c", 3))
+	empty.Add(NewFile("d", 4))
+	entries[2] = NewFile("replaced", 0)
+	if got := describeEntries(clone); got != "outer[inner[a(1)] shared(7)] empty[] b(2)" {
+		t.Errorf("clone after mutating the original = %s", got)
+	}
+	if cloneEntries(nil) != nil {
+		t.Error("cloneEntries(nil) should stay nil")
+	}
+}
+
+// Caretaker は保存するときも取り出すときもメメントをコピーする
+func TestCaretakerClonesDirectoryMementos(t *testing.T) {
+	root := NewDirectory("root")
+	root.Add(NewFile("a", 1))
+	caretaker := NewCaretaker(WithCaretakerOutput[*DirectoryMemento](io.Discard))
+	memento := root.CreateMemento()
+	caretaker.AddMemento(memento)
+
+	memento.entries[0].(*File).size = 50
+	got := caretaker.GetLatestMemento()
+	got.entries = append(got.entries, NewFile("b", 2))
+	if desc := describeEntries(caretaker.GetLatestMemento().entries); desc != "a(1)" {
+		t.Errorf("saved memento = %s, want a(1)", desc)
+	}
+}
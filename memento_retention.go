@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoMemento = errors.New("memento not found")
+	ErrPinExists = errors.New("memento pin already exists")
+)
+
+// MementoEntry は Caretaker が保存しているメメント1件と、その保存日時・ピンの名前
+type MementoEntry[S any] struct {
+	Index   int
+	Memento S
+	SavedAt time.Time
+	Pin     string
+}
+
+// RetentionPolicy は古い順に並んだ entries のうち、残すものに true を入れて返す。
+// Caretaker はどれか1つのポリシーが残すと決めたメメントと、ピン留めしたメメントを残す。
+// entries の Memento は Caretaker が保存しているものをコピーせずに渡すので、書き換えてはいけない。
+type RetentionPolicy[S any] func(entries []MementoEntry[S]) []bool
+
+// WithRetention は保存するたびに policies で古いメメントを削除する
+func WithRetention[S Cloner[S]](policies ...RetentionPolicy[S]) CaretakerOption[S] {
+	return func(c *Caretaker[S]) {
+		c.policies = append(c.policies, policies...)
+	}
+}
+
+// WithCaretakerClock は保存日時を now で決める
+func WithCaretakerClock[S Cloner[S]](now func() time.Time) CaretakerOption[S] {
+	return func(c *Caretaker[S]) {
+		c.now = now
+	}
+}
+
+// KeepLast は新しいものから n 件を残す
+func KeepLast[S any](n int) RetentionPolicy[S] {
+	return func(entries []MementoEntry[S]) []bool {
+		keep := make([]bool, len(entries))
+		for i := max(len(entries)-n, 0); i < len(entries); i++ {
+			keep[i] = true
+		}
+		return keep
+	}
+}
+
+// KeepPerBucket は bucket が同じ値を返すメメントのうち、最も新しいものだけを残す。
+// bucket には Hourly や Daily を使う。
+func KeepPerBucket[S any](bucket func(time.Time) time.Time) RetentionPolicy[S] {
+	return func(entries []MementoEntry[S]) []bool {
+		keep := make([]bool, len(entries))
+		seen := make(map[time.Time]bool)
+		for i := len(entries) - 1; i >= 0; i-- {
+			key := bucket(entries[i].SavedAt)
+			if !seen[key] {
+				seen[key] = true
+				keep[i] = true
+			}
+		}
+		return keep
+	}
+}
+
+// Hourly は t を含む1時間の始まりを返す
+func Hourly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+// Daily は t を含む日の始まりを返す
+func Daily(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// KeepAbove は value が watermark より大きいメメントを残す。
+// Gamer のメメントなら KeepAbove((*Memento).GetMoney, 300) で所持金が 300 円を超えるものを残す。
+func KeepAbove[S any](value func(S) int, watermark int) RetentionPolicy[S] {
+	return func(entries []MementoEntry[S]) []bool {
+		keep := make([]bool, len(entries))
+		for i, entry := range entries {
+			keep[i] = value(entry.Memento) > watermark
+		}
+		return keep
+	}
+}
+
+// PruneReport は1回の削除で残した件数と、削除したメメント
+type PruneReport[S any] struct {
+	Kept   int
+	Pruned []MementoEntry[S]
+}
+
+func (r PruneReport[S]) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "残した数: %d, 削除した数: %d", r.Kept, len(r.Pruned))
+	for _, entry := range r.Pruned {
+		fmt.Fprintf(&sb, "\n  #%d %s %v", entry.Index, entry.SavedAt.Format("15:04"), entry.Memento)
+	}
+	return sb.String()
+}
+
+// Entries は保存しているメメントのコピーを古い順に返す
+func (c *Caretaker[S]) Entries() []MementoEntry[S] {
+	entries := make([]MementoEntry[S], 0, len(c.entries))
+	for i, entry := range c.entries {
+		entries = append(entries, MementoEntry[S]{
+			Index:   i,
+			Memento: entry.memento.Clone(),
+			SavedAt: entry.savedAt,
+			Pin:     entry.pin,
+		})
+	}
+	return entries
+}
+
+// Prune は保持ポリシーを今すぐ適用する。ポリシーがなければ何も削除しない。
+// メメントはコピーせず、残すものをその場で詰める。Index は削除する前の位置。
+func (c *Caretaker[S]) Prune() PruneReport[S] {
+	if len(c.policies) == 0 {
+		return PruneReport[S]{Kept: len(c.entries)}
+	}
+	entries := make([]MementoEntry[S], len(c.entries))
+	keep := make([]bool, len(c.entries))
+	for i, entry := range c.entries {
+		entries[i] = MementoEntry[S]{Index: i, Memento: entry.memento, SavedAt: entry.savedAt, Pin: entry.pin}
+		keep[i] = entry.pin != ""
+	}
+	for _, policy := range c.policies {
+		for i, k := range policy(entries) {
+			if k && i < len(keep) {
+				keep[i] = true
+			}
+		}
+	}
+
+	var report PruneReport[S]
+	kept := 0
+	for i, entry := range c.entries {
+		if keep[i] {
+			c.entries[kept] = entry
+			kept++
+		} else {
+			// 削除したメメントは Caretaker から参照されなくなるので、コピーせずにそのまま返す
+			report.Pruned = append(report.Pruned, entries[i])
+		}
+	}
+	clear(c.entries[kept:])
+	c.entries = c.entries[:kept]
+	report.Kept = kept
+	return report
+}
+
+// LastPrune は直前の AddMemento で削除したメメントを返す
+func (c *Caretaker[S]) LastPrune() PruneReport[S] {
+	return c.lastPrune
+}
+
+// Pin は index 番目のメメントに name を付け、保持ポリシーで削除されないようにする。
+// すでにピンがあれば名前を付け替える。
+func (c *Caretaker[S]) Pin(index int, name string) error {
+	if index < 0 || index >= len(c.entries) {
+		return fmt.Errorf("%w: index %d", ErrNoMemento, index)
+	}
+	if i := c.pinned(name); i >= 0 && i != index {
+		return fmt.Errorf("%w: %q", ErrPinExists, name)
+	}
+	c.entries[index].pin = name
+	return nil
+}
+
+// Unpin は name のピンを外す。外したメメントは次に削除するときから保持ポリシーの対象になる。
+func (c *Caretaker[S]) Unpin(name string) bool {
+	i := c.pinned(name)
+	if i < 0 {
+		return false
+	}
+	c.entries[i].pin = ""
+	return true
+}
+
+// GetPinned は name のピンを付けたメメントのコピーを返す
+func (c *Caretaker[S]) GetPinned(name string) (S, bool) {
+	i := c.pinned(name)
+	if i < 0 {
+		var zero S
+		return zero, false
+	}
+	return c.entries[i].memento.Clone(), true
+}
+
+func (c *Caretaker[S]) pinned(name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, entry := range c.entries {
+		if entry.pin == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func ExecMementoRetention() {
+	fmt.Println("=== Memento Retention Demo ===")
+
+	// 保存するたびに20分進む時計
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		now = now.Add(20 * time.Minute)
+		return now
+	}
+
+	gamer := NewGamer(100, WithRandSource(rand.NewSource(11)))
+	caretaker := NewCaretaker(
+		WithCaretakerClock[*Memento](clock),
+		WithRetention(
+			KeepLast[*Memento](2),
+			KeepPerBucket[*Memento](Hourly),
+			KeepAbove((*Memento).GetMoney, 300),
+		),
+	)
+	caretaker.Save(gamer)
+	caretaker.Pin(0, "初期状態")
+
+	for i := 0; i < 12; i++ {
+		gamer.Bet()
+		if gamer.GetMoney() > 100 {
+			caretaker.Save(gamer)
+			if report := caretaker.LastPrune(); len(report.Pruned) > 0 {
+				fmt.Println(report)
+			}
+		}
+	}
+
+	fmt.Println("\n--- 残ったメメント ---")
+	for _, entry := range caretaker.Entries() {
+		fmt.Printf("%s %v %s\n", entry.SavedAt.Format("15:04"), entry.Memento, entry.Pin)
+	}
+
+	fmt.Println("\n--- ピン留めしたメメントに戻す ---")
+	if initial, ok := caretaker.GetPinned("初期状態"); ok {
+		gamer.RestoreMemento(initial)
+	}
+	fmt.Printf("復帰後: %s\n", gamer)
+
+	fmt.Println("\n=== Demo completed ===")
+}
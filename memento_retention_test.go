@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var retentionStart = time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+// retentionEntries は money の所持金のメメントを、retentionStart から offsets 分ずつずらした日時で並べる
+func retentionEntries(money []int, offsets []time.Duration) []MementoEntry[*Memento] {
+	entries := make([]MementoEntry[*Memento], len(money))
+	for i := range money {
+		entries[i] = MementoEntry[*Memento]{Index: i, Memento: &Memento{money: money[i]}, SavedAt: retentionStart.Add(offsets[i])}
+	}
+	return entries
+}
+
+func keptIndexes(keep []bool) []int {
+	indexes := make([]int, 0)
+	for i, k := range keep {
+		if k {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func TestRetentionPolicies(t *testing.T) {
+	minutes := func(ms ...int) []time.Duration {
+		offsets := make([]time.Duration, len(ms))
+		for i, m := range ms {
+			offsets[i] = time.Duration(m) * time.Minute
+		}
+		return offsets
+	}
+	fiveAtOneHour := minutes(0, 60, 120, 180, 240)
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy[*Memento]
+		money   []int
+		offsets []time.Duration
+		want    []int
+	}{
+		{"KeepLast(0)", KeepLast[*Memento](0), []int{1, 2, 3, 4, 5}, fiveAtOneHour, []int{}},
+		{"KeepLast(2)", KeepLast[*Memento](2), []int{1, 2, 3, 4, 5}, fiveAtOneHour, []int{3, 4}},
+		{"KeepLast more than saved", KeepLast[*Memento](10), []int{1, 2, 3}, fiveAtOneHour[:3], []int{0, 1, 2}},
+		{"KeepLast of nothing", KeepLast[*Memento](3), nil, nil, []int{}},
+		{"KeepPerBucket hourly", KeepPerBucket[*Memento](Hourly), []int{1, 2, 3, 4, 5}, minutes(0, 20, 59, 60, 130), []int{2, 3, 4}},
+		{"KeepPerBucket daily", KeepPerBucket[*Memento](Daily), []int{1, 2, 3, 4}, minutes(0, 14*60, 15*60, 16*60), []int{1, 3}},
+		{"KeepPerBucket same time", KeepPerBucket[*Memento](Hourly), []int{1, 2}, minutes(5, 5), []int{1}},
+		{"KeepAbove", KeepAbove((*Memento).GetMoney, 300), []int{100, 300, 301, 50, 1000}, fiveAtOneHour, []int{2, 4}},
+		{"KeepAbove nothing", KeepAbove((*Memento).GetMoney, 1000), []int{100, 1000}, fiveAtOneHour[:2], []int{}},
+	}
+	for _, tt := range tests {
+		if got := keptIndexes(tt.policy(retentionEntries(tt.money, tt.offsets))); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: kept %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	at := time.Date(2024, 3, 5, 23, 45, 30, 99, tokyo)
+	if got, want := Hourly(at), time.Date(2024, 3, 5, 23, 0, 0, 0, tokyo); !got.Equal(want) || got.Location() != tokyo {
+		t.Errorf("Hourly = %v, want %v", got, want)
+	}
+	if got, want := Daily(at), time.Date(2024, 3, 5, 0, 0, 0, 0, tokyo); !got.Equal(want) {
+		t.Errorf("Daily = %v, want %v", got, want)
+	}
+}
+
+// newRetentionCaretaker は保存するたびに1時間進む時計と policies を持つ Caretaker を返す
+func newRetentionCaretaker(policies ...RetentionPolicy[*Memento]) *Caretaker[*Memento] {
+	now := retentionStart
+	return NewCaretaker(
+		WithCaretakerOutput[*Memento](io.Discard),
+		WithCaretakerClock[*Memento](func() time.Time {
+			now = now.Add(time.Hour)
+			return now
+		}),
+		WithRetention(policies...),
+	)
+}
+
+func savedMoney(c *Caretaker[*Memento]) []int {
+	money := make([]int, 0)
+	for _, entry := range c.Entries() {
+		money = append(money, entry.Memento.GetMoney())
+	}
+	return money
+}
+
+// どれか1つのポリシーが残すと決めたものと、ピン留めしたものが残る
+func TestPruneKeepsUnionAndPins(t *testing.T) {
+	caretaker := newRetentionCaretaker(KeepLast[*Memento](1), KeepAbove((*Memento).GetMoney, 500))
+	caretaker.AddMemento(&Memento{money: 100})
+	if err := caretaker.Pin(0, "initial"); err != nil {
+		t.Fatal(err)
+	}
+	for _, money := range []int{200, 900, 300, 400} {
+		caretaker.AddMemento(&Memento{money: money})
+	}
+	if got := savedMoney(caretaker); !slices.Equal(got, []int{100, 900, 400}) {
+		t.Errorf("saved %v, want the pinned, the rich and the latest", got)
+	}
+	report := caretaker.LastPrune()
+	if report.Kept != 3 || len(report.Pruned) != 1 || report.Pruned[0].Index != 2 || report.Pruned[0].Memento.GetMoney() != 300 {
+		t.Errorf("last prune = %+v, want #2 (300) pruned", report)
+	}
+
+	if !caretaker.Unpin("initial") {
+		t.Fatal("Unpin(initial) = false")
+	}
+	if caretaker.Unpin("initial") {
+		t.Error("Unpin of a removed pin = true")
+	}
+	// ピンを外しただけでは削除せず、次の Prune で削除する
+	if got := savedMoney(caretaker); !slices.Equal(got, []int{100, 900, 400}) {
+		t.Errorf("saved after Unpin = %v", got)
+	}
+	report = caretaker.Prune()
+	if got := savedMoney(caretaker); !slices.Equal(got, []int{900, 400}) {
+		t.Errorf("saved after Prune = %v", got)
+	}
+	if want := "残した数: 2, 削除した数: 1\n  #0 10:00 [money = 100, fruits = []]"; report.String() != want {
+		t.Errorf("report = %q, want %q", report.String(), want)
+	}
+}
+
+func TestPruneWithoutPolicies(t *testing.T) {
+	caretaker := newRetentionCaretaker()
+	for i := 0; i < 5; i++ {
+		caretaker.AddMemento(&Memento{money: i})
+	}
+	if report := caretaker.Prune(); report.Kept != 5 || len(report.Pruned) != 0 {
+		t.Errorf("report = %+v, want nothing pruned", report)
+	}
+}
+
+func TestPins(t *testing.T) {
+	caretaker := newRetentionCaretaker()
+	caretaker.AddMemento(&Memento{money: 1})
+	caretaker.AddMemento(&Memento{money: 2})
+
+	if err := caretaker.Pin(2, "x"); !errors.Is(err, ErrNoMemento) {
+		t.Errorf("Pin out of range: error = %v, want ErrNoMemento", err)
+	}
+	if err := caretaker.Pin(-1, "x"); !errors.Is(err, ErrNoMemento) {
+		t.Errorf("Pin(-1): error = %v, want ErrNoMemento", err)
+	}
+	if err := caretaker.Pin(0, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := caretaker.Pin(1, "a"); !errors.Is(err, ErrPinExists) {
+		t.Errorf("Pin with a used name: error = %v, want ErrPinExists", err)
+	}
+	// 同じメメントに付け直すのは構わない。名前を変えると古い名前では取り出せなくなる。
+	if err := caretaker.Pin(0, "a"); err != nil {
+		t.Errorf("Pin the same name again: %v", err)
+	}
+	if err := caretaker.Pin(0, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := caretaker.GetPinned("a"); ok {
+		t.Error("GetPinned(a) found a renamed pin")
+	}
+	pinned, ok := caretaker.GetPinned("b")
+	if !ok || pinned.GetMoney() != 1 {
+		t.Fatalf("GetPinned(b) = %v, %v", pinned, ok)
+	}
+	pinned.money = 999
+	if again, _ := caretaker.GetPinned("b"); again.GetMoney() != 1 {
+		t.Error("GetPinned returned the saved memento instead of a copy")
+	}
+	if _, ok := caretaker.GetPinned(""); ok {
+		t.Error(`GetPinned("") found an unpinned memento`)
+	}
+}
+
+// countingMemento は Clone された回数を数える
+type countingMemento struct {
+	value  int
+	clones *int
+}
+
+func (m *countingMemento) Clone() *countingMemento {
+	*m.clones++
+	return &countingMemento{value: m.value, clones: m.clones}
+}
+
+// 保存するたびに Prune しても、保存するときの1回しかコピーしない
+func TestPruneDoesNotCloneMementos(t *testing.T) {
+	clones := 0
+	var seen []*countingMemento
+	caretaker := NewCaretaker(
+		WithCaretakerOutput[*countingMemento](io.Discard),
+		WithRetention(func(entries []MementoEntry[*countingMemento]) []bool {
+			seen = seen[:0]
+			for _, entry := range entries {
+				seen = append(seen, entry.Memento)
+			}
+			return KeepLast[*countingMemento](3)(entries)
+		}),
+	)
+	for i := 0; i < 10; i++ {
+		caretaker.AddMemento(&countingMemento{value: i, clones: &clones})
+	}
+	if clones != 10 {
+		t.Errorf("%d clones for 10 saves, want 10", clones)
+	}
+	if got := caretaker.GetMementoCount(); got != 3 {
+		t.Errorf("%d mementos, want 3", got)
+	}
+	// ポリシーには保存しているメメントがそのまま渡る
+	if caretaker.entries[2].memento != seen[len(seen)-1] {
+		t.Error("the policy got a copy of the saved memento")
+	}
+	// 詰めた後ろの要素は参照を残さない
+	if tail := caretaker.entries[:cap(caretaker.entries)][len(caretaker.entries):]; slices.ContainsFunc(tail, func(e caretakerEntry[*countingMemento]) bool { return e.memento != nil }) {
+		t.Error("pruned entries are still referenced by the backing array")
+	}
+	var values []string
+	for _, entry := range caretaker.Entries() {
+		values = append(values, string(rune('0'+entry.Memento.value)))
+	}
+	if got := strings.Join(values, ""); got != "789" {
+		t.Errorf("kept %s, want 789", got)
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMementoFormat   = errors.New("memento file: invalid format")
+	ErrMementoVersion  = errors.New("memento file: unsupported version")
+	ErrMementoChecksum = errors.New("memento file: checksum mismatch")
+)
+
+type MementoFormat int
+
+const (
+	MementoJSON MementoFormat = iota
+	MementoBinary
+)
+
+// mementoVersion は書き出すファイルのバージョン。それより古いバージョンは、読み込み時に現在の形に変換する。
+// バージョン 1 には保存日時とピンがなかった。
+// バージョン 2 までの JSON 形式は、チェックサムが mementos だけを対象にしていた。
+const mementoVersion = 3
+
+const (
+	mementoFormatName = "memento"
+	mementoMagic      = "MMTO"
+)
+
+// mementoRecord はファイルに保存する1件分のメメント。SavedAt がゼロなら保存日時は不明で、読み込んだ日時で補う。
+type mementoRecord struct {
+	Money   int       `json:"money"`
+	Fruits  []string  `json:"fruits"`
+	SavedAt time.Time `json:"saved_at"`
+	Pin     string    `json:"pin,omitempty"`
+}
+
+// mementoFile は JSON 形式のファイル全体。Checksum は Format・Version と、空白を取り除いた Mementos のチェックサム。
+type mementoFile struct {
+	Format   string          `json:"format"`
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"`
+	Mementos json.RawMessage `json:"mementos"`
+}
+
+// mementoSum は data のチェックサムを返す。key が nil なら SHA-256 で、破損は検出できるが、
+// 内容を書き換えてチェックサムを計算し直す改ざんは検出できない。
+// 改ざんも検出するには、呼び出し側で管理する鍵を key に渡す。チェックサムは key を使った HMAC-SHA256 になる。
+func mementoSum(data, key []byte) []byte {
+	if key == nil {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func mementoChecksum(data, key []byte) string {
+	return hex.EncodeToString(mementoSum(data, key))
+}
+
+// mementoJSONChecksum は JSON 形式のファイルのチェックサムを返す。
+// バイナリ形式と同じくヘッダーも対象にし、バージョンを書き換えて古い形式として読ませることもできないようにする。
+func mementoJSONChecksum(format string, version int, payload, key []byte) string {
+	if version < 3 {
+		return mementoChecksum(payload, key)
+	}
+	data := fmt.Appendf(nil, "%s\n%d\n", format, version)
+	return mementoChecksum(append(data, payload...), key)
+}
+
+func mementoRecords(c *Caretaker[*Memento]) []mementoRecord {
+	records := make([]mementoRecord, 0, len(c.entries))
+	for _, entry := range c.entries {
+		records = append(records, mementoRecord{
+			Money:   entry.memento.money,
+			Fruits:  entry.memento.GetFruits(),
+			SavedAt: entry.savedAt,
+			Pin:     entry.pin,
+		})
+	}
+	return records
+}
+
+// SaveCaretaker は c が保存しているメメントを format で w に書き出す。
+// key を渡すと HMAC-SHA256 で署名し、同じ key で読み込んだときだけ改ざんがないと確かめられる。
+// key が nil なら SHA-256 のチェックサムを付け、破損だけを検出する。
+func SaveCaretaker(w io.Writer, c *Caretaker[*Memento], format MementoFormat, key []byte) error {
+	var data []byte
+	var err error
+	switch format {
+	case MementoJSON:
+		data, err = encodeMementoJSON(mementoRecords(c), key)
+	case MementoBinary:
+		data = encodeMementoBinary(mementoRecords(c), key)
+	default:
+		err = fmt.Errorf("%w: unknown format %d", ErrMementoFormat, format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// SaveCaretakerFile は path に書き出す。書き込みは一時ファイルを経由するので、失敗しても元のファイルは壊れない。
+func SaveCaretakerFile(path string, c *Caretaker[*Memento], format MementoFormat, key []byte) error {
+	var buf bytes.Buffer
+	if err := SaveCaretaker(&buf, c, format, key); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// LoadCaretaker は JSON・バイナリのどちらの形式も読み込む。key には保存したときと同じ鍵を渡す。
+// 古いバージョンは現在の形に変換し、チェックサムが合わなければ ErrMementoChecksum を返す。
+// 読み込んだ Caretaker には options を適用する。保持ポリシーは次に AddMemento か Prune を呼んだときから効く。
+func LoadCaretaker(r io.Reader, key []byte, options ...CaretakerOption[*Memento]) (*Caretaker[*Memento], error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var records []mementoRecord
+	if bytes.HasPrefix(data, []byte(mementoMagic)) {
+		records, err = decodeMementoBinary(data, key)
+	} else {
+		records, err = decodeMementoJSON(data, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	caretaker := NewCaretaker(options...)
+	loadedAt := caretaker.now()
+	for _, record := range records {
+		if caretaker.pinned(record.Pin) >= 0 {
+			return nil, fmt.Errorf("%w: duplicate pin %q", ErrMementoFormat, record.Pin)
+		}
+		if record.SavedAt.IsZero() {
+			record.SavedAt = loadedAt
+		}
+		caretaker.entries = append(caretaker.entries, caretakerEntry[*Memento]{
+			memento: &Memento{money: record.Money, fruits: record.Fruits},
+			savedAt: record.SavedAt,
+			pin:     record.Pin,
+		})
+	}
+	return caretaker, nil
+}
+
+func LoadCaretakerFile(path string, key []byte, options ...CaretakerOption[*Memento]) (*Caretaker[*Memento], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	caretaker, err := LoadCaretaker(f, key, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return caretaker, nil
+}
+
+func encodeMementoJSON(records []mementoRecord, key []byte) ([]byte, error) {
+	payload, err := json.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(mementoFile{
+		Format:   mementoFormatName,
+		Version:  mementoVersion,
+		Checksum: mementoJSONChecksum(mementoFormatName, mementoVersion, payload, key),
+		Mementos: payload,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// mementoJSONMigrations[v] はバージョン v の mementos をバージョン v+1 の形に変換する
+var mementoJSONMigrations = map[int]func(json.RawMessage) (json.RawMessage, error){
+	// バージョン 1 には保存日時とピンがない。保存日時は空のままにして、読み込んだ日時で補う。
+	1: func(payload json.RawMessage) (json.RawMessage, error) {
+		var old []struct {
+			Money  int      `json:"money"`
+			Fruits []string `json:"fruits"`
+		}
+		if err := json.Unmarshal(payload, &old); err != nil {
+			return nil, err
+		}
+		records := make([]mementoRecord, 0, len(old))
+		for _, m := range old {
+			records = append(records, mementoRecord{Money: m.Money, Fruits: m.Fruits})
+		}
+		return json.Marshal(records)
+	},
+	// バージョン 3 はチェックサムの対象が変わっただけで、mementos の形は同じ
+	2: func(payload json.RawMessage) (json.RawMessage, error) {
+		return payload, nil
+	},
+}
+
+func decodeMementoJSON(data, key []byte) ([]mementoRecord, error) {
+	var file mementoFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMementoFormat, err)
+	}
+	if file.Format != mementoFormatName {
+		return nil, fmt.Errorf("%w: format %q", ErrMementoFormat, file.Format)
+	}
+	if file.Version < 1 || file.Version > mementoVersion {
+		return nil, fmt.Errorf("%w: %d", ErrMementoVersion, file.Version)
+	}
+	// 変換する前に、保存されたままの内容で確かめる。インデントの違いは内容の違いとみなさない。
+	var payload bytes.Buffer
+	if err := json.Compact(&payload, file.Mementos); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMementoFormat, err)
+	}
+	if !hmac.Equal([]byte(mementoJSONChecksum(file.Format, file.Version, payload.Bytes(), key)), []byte(file.Checksum)) {
+		return nil, ErrMementoChecksum
+	}
+	return migrateMementoJSON(file.Version, payload.Bytes())
+}
+
+func migrateMementoJSON(version int, payload json.RawMessage) ([]mementoRecord, error) {
+	for ; version < mementoVersion; version++ {
+		migrated, err := mementoJSONMigrations[version](payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: migrate version %d: %v", ErrMementoFormat, version, err)
+		}
+		payload = migrated
+	}
+	var records []mementoRecord
+	if err := json.Unmarshal(payload, &records); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMementoFormat, err)
+	}
+	return records, nil
+}
+
+// バイナリ形式は "MMTO"、バージョン（uint16）、本体、それまでの全バイトのチェックサム（32バイト）の順に並べる。
+// 本体は件数に続けて、メメントごとに所持金（varint）、フルーツの数・各フルーツ（長さ付き文字列）、
+// 保存日時（Unix 時間のナノ秒、varint）、ピン（長さ付き文字列）を並べる。バージョン 1 には保存日時とピンがない。
+// バージョン 3 は JSON 形式に合わせて上げただけで、2 と同じ形。
+func encodeMementoBinary(records []mementoRecord, key []byte) []byte {
+	data := []byte(mementoMagic)
+	data = binary.BigEndian.AppendUint16(data, mementoVersion)
+	data = binary.AppendUvarint(data, uint64(len(records)))
+	for _, record := range records {
+		data = binary.AppendVarint(data, int64(record.Money))
+		data = binary.AppendUvarint(data, uint64(len(record.Fruits)))
+		for _, fruit := range record.Fruits {
+			data = appendBinaryString(data, fruit)
+		}
+		data = binary.AppendVarint(data, record.SavedAt.UnixNano())
+		data = appendBinaryString(data, record.Pin)
+	}
+	return append(data, mementoSum(data, key)...)
+}
+
+func appendBinaryString(data []byte, s string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(s)))
+	return append(data, s...)
+}
+
+func decodeMementoBinary(data, key []byte) ([]mementoRecord, error) {
+	header := len(mementoMagic) + 2
+	if len(data) < header+sha256.Size {
+		return nil, fmt.Errorf("%w: file is too short", ErrMementoFormat)
+	}
+	body, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if !hmac.Equal(mementoSum(body, key), sum) {
+		return nil, ErrMementoChecksum
+	}
+	version := int(binary.BigEndian.Uint16(body[len(mementoMagic):]))
+	r := &binaryReader{data: body[header:]}
+	var records []mementoRecord
+	switch version {
+	case 1:
+		records = decodeMementoBinaryRecords(r, false)
+	case 2, 3:
+		records = decodeMementoBinaryRecords(r, true)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrMementoVersion, version)
+	}
+	if r.err == nil && len(r.data) > 0 {
+		r.err = fmt.Errorf("%d trailing bytes", len(r.data))
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMementoFormat, r.err)
+	}
+	return records, nil
+}
+
+// decodeMementoBinaryRecords は本体を読む。stamped が false（バージョン 1）なら保存日時とピンは読まない。
+func decodeMementoBinaryRecords(r *binaryReader, stamped bool) []mementoRecord {
+	count := r.count()
+	records := make([]mementoRecord, 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		record := mementoRecord{Money: int(r.varint())}
+		fruits := r.count()
+		record.Fruits = make([]string, 0, fruits)
+		for j := 0; j < fruits && r.err == nil; j++ {
+			record.Fruits = append(record.Fruits, r.string())
+		}
+		if stamped {
+			record.SavedAt = time.Unix(0, r.varint())
+			record.Pin = r.string()
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// binaryReader は最初のエラーを覚えておき、それ以降の読み込みでは何もしない
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errors.New("invalid uvarint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errors.New("invalid varint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// count は要素数を読む。残りのバイト数より多い数は壊れたデータとして扱い、巨大な確保を避ける。
+func (r *binaryReader) count() int {
+	n := r.uvarint()
+	if r.err == nil && n > uint64(len(r.data)) {
+		r.err = fmt.Errorf("count %d exceeds remaining %d bytes", n, len(r.data))
+		return 0
+	}
+	return int(n)
+}
+
+func (r *binaryReader) string() string {
+	n := r.count()
+	if r.err != nil {
+		return ""
+	}
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+func ExecMementoStorage() {
+	fmt.Println("=== Memento Storage Demo ===")
+
+	dir, err := os.MkdirTemp("", "memento")
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	clock := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	now := func() time.Time {
+		clock = clock.Add(time.Hour)
+		return clock
+	}
+	caretaker := NewCaretaker(WithCaretakerClock[*Memento](now))
+	caretaker.AddMemento(&Memento{money: 100})
+	caretaker.AddMemento(&Memento{money: 250, fruits: []string{"りんご", "おいしいりんご"}})
+	caretaker.Pin(1, "best")
+
+	print := func(label string, c *Caretaker[*Memento]) {
+		fmt.Printf("%s:", label)
+		for _, entry := range c.Entries() {
+			fmt.Printf(" [お金=%d, フルーツ=%v, %s", entry.Memento.GetMoney(), entry.Memento.GetFruits(), entry.SavedAt.UTC().Format("15:04"))
+			if entry.Pin != "" {
+				fmt.Printf(", ピン=%s", entry.Pin)
+			}
+			fmt.Print("]")
+		}
+		fmt.Println()
+	}
+
+	fmt.Println("\n--- JSON とバイナリで保存して読み込む ---")
+	for _, format := range []struct {
+		name   string
+		ext    string
+		format MementoFormat
+	}{{"JSON", "json", MementoJSON}, {"バイナリ", "bin", MementoBinary}} {
+		path := filepath.Join(dir, "mementos."+format.ext)
+		if err := SaveCaretakerFile(path, caretaker, format.format, nil); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			continue
+		}
+		info, _ := os.Stat(path)
+		loaded, err := LoadCaretakerFile(path, nil)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			continue
+		}
+		print(fmt.Sprintf("%s (%dバイト)", format.name, info.Size()), loaded)
+	}
+
+	fmt.Println("\n--- バージョン 1 のファイルを読み込む（保存日時は読み込んだ日時で補う） ---")
+	payload := `[{"money":300,"fruits":["ぶどう"]},{"money":120,"fruits":[]}]`
+	v1 := fmt.Sprintf(`{"format":"memento","version":1,"checksum":%q,"mementos":%s}`, mementoChecksum([]byte(payload), nil), payload)
+	if loaded, err := LoadCaretaker(strings.NewReader(v1), nil, WithCaretakerClock[*Memento](now)); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	} else {
+		print("v1", loaded)
+	}
+
+	fmt.Println("\n--- 保持ポリシーを付けて読み込む ---")
+	path := filepath.Join(dir, "mementos.bin")
+	loaded, err := LoadCaretakerFile(path, nil, WithCaretakerClock[*Memento](now), WithRetention(KeepLast[*Memento](1)))
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+	} else {
+		loaded.AddMemento(&Memento{money: 400})
+		print("読み込んで1件保存", loaded)
+		fmt.Println(loaded.LastPrune())
+	}
+
+	fmt.Println("\n--- 破損の検出 ---")
+	var buf bytes.Buffer
+	SaveCaretaker(&buf, caretaker, MementoBinary, nil)
+	corrupted := buf.Bytes()
+	corrupted[8] ^= 0xFF
+	if _, err := LoadCaretaker(bytes.NewReader(corrupted), nil); err != nil {
+		fmt.Printf("バイナリ: %v\n", err)
+	}
+
+	fmt.Println("\n--- 鍵を使った改ざんの検出 ---")
+	// forge は所持金を書き換え、鍵を使わないチェックサムを計算し直す
+	forge := func(data []byte) io.Reader {
+		var file mementoFile
+		json.Unmarshal(data, &file)
+		var payload bytes.Buffer
+		json.Compact(&payload, file.Mementos)
+		file.Mementos = bytes.Replace(payload.Bytes(), []byte(`"money":250`), []byte(`"money":999999`), 1)
+		file.Checksum = mementoJSONChecksum(file.Format, file.Version, file.Mementos, nil)
+		forged, _ := json.Marshal(file)
+		return bytes.NewReader(forged)
+	}
+	buf.Reset()
+	SaveCaretaker(&buf, caretaker, MementoJSON, nil)
+	if loaded, err := LoadCaretaker(forge(buf.Bytes()), nil); err == nil {
+		print("鍵なし（改ざんに気づけない）", loaded)
+	}
+	key := []byte("memento-signing-key")
+	buf.Reset()
+	SaveCaretaker(&buf, caretaker, MementoJSON, key)
+	if _, err := LoadCaretaker(forge(buf.Bytes()), key); err != nil {
+		fmt.Printf("鍵あり: %v\n", err)
+	}
+	if _, err := LoadCaretaker(bytes.NewReader(buf.Bytes()), []byte("wrong key")); err != nil {
+		fmt.Printf("違う鍵: %v\n", err)
+	}
+
+	fmt.Println("\n=== Demo completed ===")
+}
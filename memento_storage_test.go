@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaretakerRoundTrip(t *testing.T) {
+	savedAt := time.Date(2025, 1, 1, 9, 30, 0, 123, time.UTC)
+	caretaker := NewCaretaker(quietCaretaker, WithCaretakerClock[*Memento](func() time.Time { return savedAt }))
+	caretaker.AddMemento(&Memento{money: 100})
+	caretaker.AddMemento(&Memento{money: 250, fruits: []string{"りんご", "ぶどう"}})
+	caretaker.Pin(1, "best")
+	for _, format := range []MementoFormat{MementoJSON, MementoBinary} {
+		for _, key := range [][]byte{nil, []byte("key")} {
+			var buf bytes.Buffer
+			if err := SaveCaretaker(&buf, caretaker, format, key); err != nil {
+				t.Fatalf("format %d: SaveCaretaker: %v", format, err)
+			}
+			loaded, err := LoadCaretaker(&buf, key, quietCaretaker)
+			if err != nil {
+				t.Fatalf("format %d, key %q: LoadCaretaker: %v", format, key, err)
+			}
+			if got := loaded.GetMementoCount(); got != 2 {
+				t.Fatalf("format %d: %d mementos, want 2", format, got)
+			}
+			entry := loaded.Entries()[1]
+			if entry.Memento.GetMoney() != 250 || !slices.Equal(entry.Memento.GetFruits(), []string{"りんご", "ぶどう"}) {
+				t.Errorf("format %d: memento = %v", format, entry.Memento)
+			}
+			if !entry.SavedAt.Equal(savedAt) || entry.Pin != "best" {
+				t.Errorf("format %d: saved at %v, pin %q, want %v, %q", format, entry.SavedAt, entry.Pin, savedAt, "best")
+			}
+		}
+	}
+}
+
+// 鍵付きで保存したファイルは、チェックサムを計算し直しても鍵がなければ書き換えられない
+func TestCaretakerKeyDetectsTampering(t *testing.T) {
+	caretaker := NewCaretaker(quietCaretaker)
+	caretaker.AddMemento(&Memento{money: 100})
+	key := []byte("secret")
+	for _, format := range []MementoFormat{MementoJSON, MementoBinary} {
+		var signed, plain bytes.Buffer
+		SaveCaretaker(&signed, caretaker, format, key)
+		SaveCaretaker(&plain, caretaker, format, nil)
+		tests := []struct {
+			name string
+			data []byte
+			key  []byte
+		}{
+			{"wrong key", signed.Bytes(), []byte("guess")},
+			{"no key", signed.Bytes(), nil},
+			{"unsigned file", plain.Bytes(), key},
+		}
+		for _, tt := range tests {
+			if _, err := LoadCaretaker(bytes.NewReader(tt.data), tt.key, quietCaretaker); !errors.Is(err, ErrMementoChecksum) {
+				t.Errorf("format %d, %s: error = %v, want ErrMementoChecksum", format, tt.name, err)
+			}
+		}
+	}
+}
+
+// バージョン 1 のファイルには保存日時とピンがないので、読み込んだ日時で補う
+func TestLoadCaretakerVersion1(t *testing.T) {
+	payload := `[{"money":300,"fruits":["ぶどう"]}]`
+	jsonV1 := fmt.Sprintf(`{"format":"memento","version":1,"checksum":%q,"mementos":%s}`, mementoChecksum([]byte(payload), nil), payload)
+
+	binaryV1 := []byte(mementoMagic)
+	binaryV1 = binary.BigEndian.AppendUint16(binaryV1, 1)
+	binaryV1 = binary.AppendUvarint(binaryV1, 1)
+	binaryV1 = binary.AppendVarint(binaryV1, 300)
+	binaryV1 = binary.AppendUvarint(binaryV1, 1)
+	binaryV1 = appendBinaryString(binaryV1, "ぶどう")
+	sum := sha256.Sum256(binaryV1)
+	binaryV1 = append(binaryV1, sum[:]...)
+
+	loadedAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	for name, data := range map[string]string{"json": jsonV1, "binary": string(binaryV1)} {
+		loaded, err := LoadCaretaker(strings.NewReader(data), nil, quietCaretaker,
+			WithCaretakerClock[*Memento](func() time.Time { return loadedAt }),
+			WithRetention(KeepLast[*Memento](1)),
+		)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		entries := loaded.Entries()
+		if len(entries) != 1 || entries[0].Memento.GetMoney() != 300 || !slices.Equal(entries[0].Memento.GetFruits(), []string{"ぶどう"}) {
+			t.Fatalf("%s: entries = %+v", name, entries)
+		}
+		if !entries[0].SavedAt.Equal(loadedAt) || entries[0].Pin != "" {
+			t.Errorf("%s: saved at %v, pin %q", name, entries[0].SavedAt, entries[0].Pin)
+		}
+		// 読み込みで渡したオプションが効いている
+		loaded.AddMemento(&Memento{money: 1})
+		if got := loaded.GetMementoCount(); got != 1 {
+			t.Errorf("%s: %d mementos after AddMemento with KeepLast(1)", name, got)
+		}
+	}
+}
+
+// JSON 形式のチェックサムはヘッダーも対象にするので、バージョンを書き換えると読み込めない
+func TestCaretakerJSONHeaderTampering(t *testing.T) {
+	caretaker := NewCaretaker(quietCaretaker)
+	caretaker.AddMemento(&Memento{money: 100})
+	for _, key := range [][]byte{nil, []byte("secret")} {
+		var buf bytes.Buffer
+		if err := SaveCaretaker(&buf, caretaker, MementoJSON, key); err != nil {
+			t.Fatal(err)
+		}
+		current := fmt.Sprintf(`"version": %d`, mementoVersion)
+		if !bytes.Contains(buf.Bytes(), []byte(current)) {
+			t.Fatalf("saved file has no %s:\n%s", current, buf.Bytes())
+		}
+		for _, version := range []int{1, 2} {
+			tampered := bytes.Replace(buf.Bytes(), []byte(current), fmt.Appendf(nil, `"version": %d`, version), 1)
+			if _, err := LoadCaretaker(bytes.NewReader(tampered), key, quietCaretaker); !errors.Is(err, ErrMementoChecksum) {
+				t.Errorf("key %q, version %d: error = %v, want ErrMementoChecksum", key, version, err)
+			}
+		}
+	}
+}
+
+// バージョン 2 の JSON ファイルは mementos だけのチェックサムのまま読み込める
+func TestLoadCaretakerVersion2JSON(t *testing.T) {
+	payload := `[{"money":300,"fruits":["ぶどう"],"saved_at":"2025-01-01T00:00:00Z","pin":"best"}]`
+	key := []byte("secret")
+	data := fmt.Sprintf(`{"format":"memento","version":2,"checksum":%q,"mementos":%s}`, mementoChecksum([]byte(payload), key), payload)
+	loaded, err := LoadCaretaker(strings.NewReader(data), key, quietCaretaker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := loaded.Entries()
+	if len(entries) != 1 || entries[0].Memento.GetMoney() != 300 || entries[0].Pin != "best" {
+		t.Errorf("entries = %+v", entries)
+	}
+}
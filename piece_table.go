@@ -0,0 +1,359 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// piece は元の文字列または挿入された文字列の一部を参照する。
+// Go の部分文字列は元の文字列とメモリを共有するので、分割してもコピーは発生しない。
+type piece struct {
+	text  string
+	runes int
+	// graphemes はこの piece の中で始まる書記素クラスタの数。まだ数えていなければ -1。
+	// 前の piece の内容によって変わるので、編集のたびに影響する piece だけ数え直す。
+	graphemes int
+}
+
+const (
+	// maxPieceSize は1つの piece の最大バイト数。
+	// 大きな文字列を分割しておくと、piece を分割したり文字数を数え直したりする範囲がこの大きさに収まる。
+	maxPieceSize = 4 << 10
+	// mergePieceSize 以下に収まる短い挿入は直前の piece と連結し、1文字ずつの入力で piece が増え続けないようにする
+	mergePieceSize = 1 << 10
+)
+
+func newPiece(text string) piece {
+	return piece{text: text, runes: utf8.RuneCountInString(text), graphemes: -1}
+}
+
+// newPieces は text を maxPieceSize 以下の piece に文字の区切りで分割する
+func newPieces(text string) []piece {
+	pieces := make([]piece, 0, len(text)/maxPieceSize+1)
+	for len(text) > maxPieceSize {
+		n := maxPieceSize
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		pieces = append(pieces, newPiece(text[:n]))
+		text = text[n:]
+	}
+	if text != "" {
+		pieces = append(pieces, newPiece(text))
+	}
+	return pieces
+}
+
+// pieceTable は TextEditor の内容を保持するピーステーブル。
+// 編集は piece の分割・差し替えだけで行い、文書の内容はコピーしない。
+// ただし piece は配列に並べて持つので、位置の検索と配列の差し替えは piece の数に比例する。
+// 1回の編集の手間は文書サイズ / maxPieceSize 程度（4 MB で千件ほど）の piece を調べる分だけ増える。
+type pieceTable struct {
+	pieces []piece
+	length int
+	// cache は String() の結果。編集のたびに破棄する。
+	cache string
+	valid bool
+}
+
+func newPieceTable(text string) *pieceTable {
+	pt := &pieceTable{}
+	pt.Replace(0, 0, text)
+	return pt
+}
+
+func (pt *pieceTable) Len() int {
+	return pt.length
+}
+
+func (pt *pieceTable) String() string {
+	if !pt.valid {
+		var sb strings.Builder
+		sb.Grow(pt.length)
+		for _, p := range pt.pieces {
+			sb.WriteString(p.text)
+		}
+		pt.cache = sb.String()
+		pt.valid = true
+	}
+	return pt.cache
+}
+
+// Slice はバイト位置 start から end までの文字列を返す。
+// 返す文字列はコピーなので、履歴に保存しても文書全体や元の piece を保持し続けない。
+func (pt *pieceTable) Slice(start, end int) string {
+	if start >= end {
+		return ""
+	}
+	if pt.valid {
+		return strings.Clone(pt.cache[start:end])
+	}
+	i, offset := pt.find(start)
+	if i < len(pt.pieces) && offset+(end-start) <= len(pt.pieces[i].text) {
+		return strings.Clone(pt.pieces[i].text[offset : offset+(end-start)])
+	}
+	var sb strings.Builder
+	sb.Grow(end - start)
+	for remaining := end - start; remaining > 0; i++ {
+		text := pt.pieces[i].text[offset:]
+		if len(text) > remaining {
+			text = text[:remaining]
+		}
+		sb.WriteString(text)
+		remaining -= len(text)
+		offset = 0
+	}
+	return sb.String()
+}
+
+// Replace はバイト位置 pos から removeLen バイトを text に置き換える
+func (pt *pieceTable) Replace(pos, removeLen int, text string) {
+	i, offset := pt.find(pos)
+	replacement := make([]piece, 0, 3)
+	if offset > 0 {
+		replacement = append(replacement, newPiece(pt.pieces[i].text[:offset]))
+	}
+	replacement = append(replacement, newPieces(text)...)
+
+	j := i
+	remaining := removeLen + offset
+	for j < len(pt.pieces) && remaining >= len(pt.pieces[j].text) {
+		remaining -= len(pt.pieces[j].text)
+		j++
+	}
+	if j < len(pt.pieces) && remaining > 0 {
+		replacement = append(replacement, newPiece(pt.pieces[j].text[remaining:]))
+		j++
+	}
+
+	pt.pieces = slices.Replace(pt.pieces, i, j, replacement...)
+	following := i + len(replacement)
+	if inserted := i + min(offset, 1); text != "" && inserted > 0 {
+		prev, next := pt.pieces[inserted-1], pt.pieces[inserted]
+		if len(prev.text)+len(next.text) <= mergePieceSize {
+			pt.pieces[inserted-1] = piece{text: prev.text + next.text, runes: prev.runes + next.runes, graphemes: -1}
+			pt.pieces = slices.Delete(pt.pieces, inserted, inserted+1)
+			following--
+		}
+	}
+	// 後ろの piece の書記素クラスタは、前の内容に関係なく区切れる位置が現れるまで変わりうる
+	for k := following; k < len(pt.pieces); k++ {
+		pt.pieces[k].graphemes = -1
+		if k+1 < len(pt.pieces) && hasGraphemeSync(pt.pieces[k].text, pt.pieces[k+1].text) {
+			break
+		}
+	}
+	pt.length += len(text) - removeLen
+	pt.valid = false
+}
+
+// find はバイト位置 pos を含む piece の番号と、その piece 内のオフセットを返す
+func (pt *pieceTable) find(pos int) (int, int) {
+	for i, p := range pt.pieces {
+		if pos < len(p.text) {
+			return i, pos
+		}
+		pos -= len(p.text)
+	}
+	return len(pt.pieces), 0
+}
+
+// Count はバイト位置 end までに含まれる unit の数を返す
+func (pt *pieceTable) Count(unit TextUnit, end int) int {
+	switch unit {
+	case UnitByte:
+		return end
+	case UnitRune:
+		n := 0
+		for _, p := range pt.pieces {
+			if end <= len(p.text) {
+				return n + utf8.RuneCountInString(p.text[:end])
+			}
+			n += p.runes
+			end -= len(p.text)
+		}
+		return n
+	}
+	n := 0
+	for i, p := range pt.pieces {
+		if end < len(p.text) {
+			pt.eachGrapheme(i, func(offset int) bool {
+				if offset >= end {
+					return false
+				}
+				n++
+				return true
+			})
+			return n
+		}
+		n += pt.graphemeCount(i)
+		end -= len(p.text)
+	}
+	return n
+}
+
+// ByteOffset は先頭から pos 単位目のバイト位置を返す。範囲外なら false。
+func (pt *pieceTable) ByteOffset(unit TextUnit, pos int) (int, bool) {
+	switch unit {
+	case UnitByte:
+		return pos, pos >= 0 && pos <= pt.length
+	case UnitRune:
+		if pos < 0 {
+			return 0, false
+		}
+		offset := 0
+		for _, p := range pt.pieces {
+			if pos <= p.runes {
+				b, _ := UnitRune.byteOffset(p.text, pos)
+				return offset + b, true
+			}
+			pos -= p.runes
+			offset += len(p.text)
+		}
+		return offset, pos == 0
+	}
+	if pos < 0 {
+		return 0, false
+	}
+	offset := 0
+	for i, p := range pt.pieces {
+		n := pt.graphemeCount(i)
+		if pos < n {
+			b := offset
+			pt.eachGrapheme(i, func(start int) bool {
+				if pos == 0 {
+					b += start
+					return false
+				}
+				pos--
+				return true
+			})
+			return b, true
+		}
+		pos -= n
+		offset += len(p.text)
+	}
+	return offset, pos == 0
+}
+
+// IsBoundary はバイト位置 b が unit の区切りかどうかを返す
+func (pt *pieceTable) IsBoundary(unit TextUnit, b int) bool {
+	switch {
+	case unit == UnitByte || b == 0 || b >= pt.length:
+		return true
+	case unit == UnitRune:
+		i, offset := pt.find(b)
+		return utf8.RuneStart(pt.pieces[i].text[offset])
+	}
+	i, offset := pt.find(b)
+	found := false
+	pt.eachGrapheme(i, func(start int) bool {
+		found = start == offset
+		return start < offset
+	})
+	return found
+}
+
+// Index はバイト位置 from 以降で sub が最初に現れる位置を返す。
+// String() のキャッシュがなければ、piece ごとと piece の境目だけを探し、文書全体を組み立てない。
+func (pt *pieceTable) Index(sub string, from int) int {
+	if pt.valid {
+		i := strings.Index(pt.cache[from:], sub)
+		if i < 0 {
+			return -1
+		}
+		return from + i
+	}
+	if sub == "" {
+		return from
+	}
+	i, offset := pt.find(from)
+	start := from - offset
+	for ; i < len(pt.pieces); i++ {
+		text := pt.pieces[i].text
+		if j := strings.Index(text[offset:], sub); j >= 0 {
+			return start + offset + j
+		}
+		end := start + len(text)
+		if lo, hi := max(end-len(sub)+1, start+offset), min(end+len(sub)-1, pt.length); lo < end && hi > end {
+			if j := strings.Index(pt.Slice(lo, hi), sub); j >= 0 {
+				return lo + j
+			}
+		}
+		start, offset = end, 0
+	}
+	return -1
+}
+
+// graphemeCount は i 番目の piece の中で始まる書記素クラスタの数を返す
+func (pt *pieceTable) graphemeCount(i int) int {
+	if pt.pieces[i].graphemes < 0 {
+		n := 0
+		pt.eachGrapheme(i, func(int) bool {
+			n++
+			return true
+		})
+		pt.pieces[i].graphemes = n
+	}
+	return pt.pieces[i].graphemes
+}
+
+// eachGrapheme は i 番目の piece の中で始まる書記素クラスタの先頭を、piece 内のオフセットで順に f に渡す。
+// f が false を返したらそこで止める。前の piece から区切りの確かな位置を探し、そこから数える。
+func (pt *pieceTable) eachGrapheme(i int, f func(offset int) bool) {
+	text := pt.pieces[i].text
+	prefix := pt.graphemePrefix(i)
+	if prefix != "" {
+		text = prefix + text
+	}
+	for b := 0; b < len(text); b += nextGrapheme(text[b:]) {
+		if b >= len(prefix) && !f(b-len(prefix)) {
+			return
+		}
+	}
+}
+
+// graphemePrefix は i 番目の piece の直前にある、区切りの確かな位置から piece の先頭までの文字列を返す
+func (pt *pieceTable) graphemePrefix(i int) string {
+	if i == 0 || i >= len(pt.pieces) {
+		return ""
+	}
+	r, _ := utf8.DecodeRuneInString(pt.pieces[i].text)
+	prefix := ""
+	for k := i - 1; k >= 0; k-- {
+		text := pt.pieces[k].text
+		for b := len(text); b > 0; {
+			prev, size := utf8.DecodeLastRuneInString(text[:b])
+			if isGraphemeSync(prev, r) {
+				return text[b:] + prefix
+			}
+			r = prev
+			b -= size
+		}
+		prefix = text + prefix
+	}
+	return prefix
+}
+
+// isGraphemeSync は直前の rune が prev で、r から始まる位置が、それより前の内容に関係なく
+// 書記素クラスタの区切りになるかどうかを返す。nextGrapheme が r を前のクラスタに含めるのは、
+// r が LF・ZWJ・地域指示記号・結合文字のときと、prev が ZWJ のときだけである。
+func isGraphemeSync(prev, r rune) bool {
+	return prev != '\u200d' && r != '\n' && r != '\u200d' && !isRegionalIndicator(r) && !isGraphemeExtend(r)
+}
+
+// hasGraphemeSync は text の先頭より後ろ、next の先頭までに isGraphemeSync を満たす位置があるかどうかを返す
+func hasGraphemeSync(text, next string) bool {
+	prev, size := utf8.DecodeRuneInString(text)
+	for b := size; b < len(text); {
+		r, n := utf8.DecodeRuneInString(text[b:])
+		if isGraphemeSync(prev, r) {
+			return true
+		}
+		prev = r
+		b += n
+	}
+	r, _ := utf8.DecodeRuneInString(next)
+	return isGraphemeSync(prev, r)
+}
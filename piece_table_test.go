@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// pieceTableFragments は piece の境目で書記素クラスタが分かれやすい断片
+var pieceTableFragments = []string{
+	"a", "b", "言", "語", "́", "‍", "👍", "🏽", "🇯", "🇵", "\r", "\n", "️", "e", " ",
+}
+
+func TestPieceTableMatchesString(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for round := 0; round < 200; round++ {
+		pt := newPieceTable("")
+		content := ""
+		for step := 0; step < 30; step++ {
+			var sb strings.Builder
+			for n := rng.Intn(4) + 1; n > 0; n-- {
+				sb.WriteString(pieceTableFragments[rng.Intn(len(pieceTableFragments))])
+			}
+			text := sb.String()
+			pos := UnitRune.count(content)
+			pos, _ = UnitRune.byteOffset(content, rng.Intn(pos+1))
+			removeLen := 0
+			if rest := content[pos:]; rest != "" && rng.Intn(3) == 0 {
+				removeLen, _ = UnitRune.byteOffset(rest, rng.Intn(UnitRune.count(rest))+1)
+			}
+			pt.Replace(pos, removeLen, text)
+			content = content[:pos] + text + content[pos+removeLen:]
+
+			for _, unit := range []TextUnit{UnitByte, UnitRune, UnitGrapheme} {
+				for b := 0; b <= len(content); b++ {
+					if got, want := pt.IsBoundary(unit, b), unit.isBoundary(content, b); got != want {
+						t.Fatalf("%q: IsBoundary(%s, %d) = %v, want %v", content, unit, b, got, want)
+					}
+					if !unit.isBoundary(content, b) {
+						continue
+					}
+					if got, want := pt.Count(unit, b), unit.count(content[:b]); got != want {
+						t.Fatalf("%q: Count(%s, %d) = %d, want %d", content, unit, b, got, want)
+					}
+				}
+				for i := -1; i <= unit.count(content)+1; i++ {
+					got, gotOK := pt.ByteOffset(unit, i)
+					want, wantOK := unit.byteOffset(content, i)
+					if gotOK != wantOK || (wantOK && got != want) {
+						t.Fatalf("%q: ByteOffset(%s, %d) = %d, %v, want %d, %v", content, unit, i, got, gotOK, want, wantOK)
+					}
+				}
+			}
+			sub := pieceTableFragments[rng.Intn(len(pieceTableFragments))] + pieceTableFragments[rng.Intn(len(pieceTableFragments))]
+			from := rng.Intn(len(content) + 1)
+			want := strings.Index(content[from:], sub)
+			if want >= 0 {
+				want += from
+			}
+			if got := pt.Index(sub, from); got != want {
+				t.Fatalf("%q: Index(%q, %d) = %d, want %d", content, sub, from, got, want)
+			}
+		}
+		if pt.String() != content {
+			t.Fatalf("String() = %q, want %q", pt.String(), content)
+		}
+	}
+}
+
+func TestPieceTableIndexAcrossPieces(t *testing.T) {
+	pt := &pieceTable{pieces: []piece{newPiece("xxnee"), newPiece("d"), newPiece("leyy")}, length: 10}
+	tests := []struct {
+		sub  string
+		from int
+		want int
+	}{
+		{"needle", 0, 2},
+		{"needle", 2, 2},
+		{"needle", 3, -1},
+		{"ed", 0, 4},
+		{"yy", 0, 8},
+		{"", 10, 10},
+	}
+	for _, tt := range tests {
+		if got := pt.Index(tt.sub, tt.from); got != tt.want {
+			t.Errorf("Index(%q, %d) = %d, want %d", tt.sub, tt.from, got, tt.want)
+		}
+	}
+}
+
+// 編集の差分は文書のキャッシュを参照せず、削除した分だけを保持する
+func TestDeleteHistoryDoesNotRetainDocument(t *testing.T) {
+	const size = 4 << 20
+	editor := NewTextEditor()
+	editor.SetContent(strings.Repeat("x", size))
+	editor.history = nil
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 20; i++ {
+		_ = editor.GetContent()
+		NewDeleteCommand(editor, 1).Execute()
+	}
+	var after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	if grown := int64(after.HeapAlloc) - int64(before.HeapAlloc); grown > 4*size {
+		t.Errorf("heap grew by %d bytes after 20 one-character deletes", grown)
+	}
+	runtime.KeepAlive(editor)
+}
+
+// benchmarkSizes は編集と取り消しの手間が文書サイズでどう変わるかを見るための大きさ
+var benchmarkSizes = []int{1 << 20, 4 << 20, 16 << 20}
+
+// benchmarkDocument はおよそ size バイトの日本語の文書を返す
+func benchmarkDocument(size int) string {
+	line := "Go言語で大きな文書を編集する。\n"
+	return strings.Repeat(line, size/len(line))
+}
+
+func benchmarkEditor(b *testing.B, unit TextUnit, run func(editor *TextEditor)) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			editor := NewTextEditor(WithTextUnit(unit))
+			editor.SetContent(benchmarkDocument(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				run(editor)
+			}
+		})
+	}
+}
+
+func BenchmarkAppend(b *testing.B) {
+	benchmarkEditor(b, UnitRune, func(editor *TextEditor) {
+		NewWriteCommand(editor, "x").Execute()
+	})
+}
+
+func BenchmarkInsertMiddle(b *testing.B) {
+	benchmarkEditor(b, UnitRune, func(editor *TextEditor) {
+		NewInsertCommand(editor, editor.Length()/2, "x").Execute()
+	})
+}
+
+func BenchmarkInsertMiddleGrapheme(b *testing.B) {
+	benchmarkEditor(b, UnitGrapheme, func(editor *TextEditor) {
+		NewInsertCommand(editor, editor.Length()/2, "x").Execute()
+	})
+}
+
+func BenchmarkDeleteLast(b *testing.B) {
+	benchmarkEditor(b, UnitRune, func(editor *TextEditor) {
+		NewDeleteCommand(editor, 1).Execute()
+	})
+}
+
+func BenchmarkDeleteMiddle(b *testing.B) {
+	benchmarkEditor(b, UnitRune, func(editor *TextEditor) {
+		middle := editor.Length() / 2
+		NewDeleteRangeCommand(editor, middle, middle+10).Execute()
+	})
+}
+
+func BenchmarkInsertUndo(b *testing.B) {
+	benchmarkEditor(b, UnitRune, func(editor *TextEditor) {
+		command := NewInsertCommand(editor, editor.Length()/2, "x")
+		command.Execute()
+		command.Undo()
+	})
+}
+
+func BenchmarkDeleteUndo(b *testing.B) {
+	benchmarkEditor(b, UnitRune, func(editor *TextEditor) {
+		middle := editor.Length() / 2
+		command := NewDeleteRangeCommand(editor, middle, middle+1000)
+		command.Execute()
+		command.Undo()
+	})
+}
+
+// invoker で取り消し・やり直しを繰り返す。履歴をたどる手間も含む。
+func BenchmarkInvokerUndoRedo(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			editor := NewTextEditor()
+			editor.SetContent(benchmarkDocument(size))
+			invoker := NewCommandInvoker()
+			for i := 0; i < 100; i++ {
+				invoker.ExecuteCommand(NewInsertCommand(editor, editor.Length()*i/100, "x"))
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				invoker.UndoLastCommand()
+				invoker.RedoLastCommand()
+			}
+		})
+	}
+}
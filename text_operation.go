@@ -0,0 +1,299 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrOperationLength = errors.New("text operation: length mismatch")
+
+// otComponent は retain・insert・delete のいずれか1つだけを持つ
+type otComponent struct {
+	retain int
+	insert string
+	delete int
+}
+
+func (c otComponent) isRetain() bool { return c.retain > 0 }
+func (c otComponent) isInsert() bool { return c.insert != "" }
+func (c otComponent) isDelete() bool { return c.delete > 0 }
+
+// TextOperation は文書全体を先頭から走査する retain / insert / delete の列で表した編集操作。
+// 長さはすべてバイト数で数える。
+type TextOperation struct {
+	components   []otComponent
+	baseLength   int
+	targetLength int
+}
+
+func NewTextOperation() *TextOperation {
+	return &TextOperation{}
+}
+
+// operationFromEdit は長さ baseLength の文書に対する1回分の textEdit を TextOperation に変換する
+func operationFromEdit(edit textEdit, baseLength int) *TextOperation {
+	return NewTextOperation().
+		Retain(edit.pos).
+		Delete(len(edit.removed)).
+		Insert(edit.inserted).
+		Retain(baseLength - edit.pos - len(edit.removed))
+}
+
+func (op *TextOperation) last() *otComponent {
+	if len(op.components) == 0 {
+		return nil
+	}
+	return &op.components[len(op.components)-1]
+}
+
+func (op *TextOperation) Retain(n int) *TextOperation {
+	if n <= 0 {
+		return op
+	}
+	op.baseLength += n
+	op.targetLength += n
+	if last := op.last(); last != nil && last.isRetain() {
+		last.retain += n
+	} else {
+		op.components = append(op.components, otComponent{retain: n})
+	}
+	return op
+}
+
+func (op *TextOperation) Insert(s string) *TextOperation {
+	if s == "" {
+		return op
+	}
+	op.targetLength += len(s)
+	n := len(op.components)
+	last := op.last()
+	switch {
+	case last != nil && last.isInsert():
+		last.insert += s
+	case last != nil && last.isDelete():
+		// 同じ位置の insert と delete は常に insert を先に置き、表現を一意にする
+		if n >= 2 && op.components[n-2].isInsert() {
+			op.components[n-2].insert += s
+		} else {
+			op.components = append(op.components, *last)
+			op.components[n-1] = otComponent{insert: s}
+		}
+	default:
+		op.components = append(op.components, otComponent{insert: s})
+	}
+	return op
+}
+
+func (op *TextOperation) Delete(n int) *TextOperation {
+	if n <= 0 {
+		return op
+	}
+	op.baseLength += n
+	if last := op.last(); last != nil && last.isDelete() {
+		last.delete += n
+	} else {
+		op.components = append(op.components, otComponent{delete: n})
+	}
+	return op
+}
+
+func (op *TextOperation) IsNoop() bool {
+	return len(op.components) == 0 || (len(op.components) == 1 && op.components[0].isRetain())
+}
+
+func (op *TextOperation) Apply(doc string) (string, error) {
+	if len(doc) != op.baseLength {
+		return "", fmt.Errorf("%w: document %d, operation %d", ErrOperationLength, len(doc), op.baseLength)
+	}
+	var sb strings.Builder
+	pos := 0
+	for _, c := range op.components {
+		switch {
+		case c.isRetain():
+			sb.WriteString(doc[pos : pos+c.retain])
+			pos += c.retain
+		case c.isInsert():
+			sb.WriteString(c.insert)
+		default:
+			pos += c.delete
+		}
+	}
+	return sb.String(), nil
+}
+
+// edits は操作を TextEditor に順に適用できる textEdit の列に変換する。text は適用前の内容。
+func (op *TextOperation) edits(text *pieceTable) []textEdit {
+	edits := make([]textEdit, 0)
+	pos, origin := 0, 0
+	for _, c := range op.components {
+		switch {
+		case c.isRetain():
+			pos += c.retain
+			origin += c.retain
+		case c.isInsert():
+			edits = append(edits, textEdit{pos: pos, inserted: c.insert})
+			pos += len(c.insert)
+		default:
+			edits = append(edits, textEdit{pos: pos, removed: text.Slice(origin, origin+c.delete)})
+			origin += c.delete
+		}
+	}
+	return edits
+}
+
+func (op *TextOperation) String() string {
+	parts := make([]string, 0, len(op.components))
+	for _, c := range op.components {
+		switch {
+		case c.isRetain():
+			parts = append(parts, fmt.Sprintf("retain(%d)", c.retain))
+		case c.isInsert():
+			parts = append(parts, fmt.Sprintf("insert(%q)", c.insert))
+		default:
+			parts = append(parts, fmt.Sprintf("delete(%d)", c.delete))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// operationCursor は操作の component を1つずつ取り出し、途中まで消費した残りを保持する
+type operationCursor struct {
+	components []otComponent
+	current    otComponent
+	ok         bool
+}
+
+func newOperationCursor(op *TextOperation) *operationCursor {
+	c := &operationCursor{components: op.components}
+	c.advance()
+	return c
+}
+
+func (c *operationCursor) advance() {
+	c.ok = len(c.components) > 0
+	if c.ok {
+		c.current = c.components[0]
+		c.components = c.components[1:]
+	} else {
+		c.current = otComponent{}
+	}
+}
+
+// Compose は op を適用した後に next を適用するのと同じ結果になる1つの操作を返す
+func (op *TextOperation) Compose(next *TextOperation) (*TextOperation, error) {
+	if op.targetLength != next.baseLength {
+		return nil, fmt.Errorf("%w: compose %d -> %d", ErrOperationLength, op.targetLength, next.baseLength)
+	}
+	composed := NewTextOperation()
+	a, b := newOperationCursor(op), newOperationCursor(next)
+	for a.ok || b.ok {
+		if a.ok && a.current.isDelete() {
+			composed.Delete(a.current.delete)
+			a.advance()
+			continue
+		}
+		if b.ok && b.current.isInsert() {
+			composed.Insert(b.current.insert)
+			b.advance()
+			continue
+		}
+		if !a.ok || !b.ok {
+			return nil, fmt.Errorf("%w: compose", ErrOperationLength)
+		}
+		switch {
+		case a.current.isRetain() && b.current.isRetain():
+			n := min(a.current.retain, b.current.retain)
+			composed.Retain(n)
+			consumeRetain(a, n)
+			consumeRetain(b, n)
+		case a.current.isInsert() && b.current.isDelete():
+			n := min(len(a.current.insert), b.current.delete)
+			consumeInsert(a, n)
+			consumeDelete(b, n)
+		case a.current.isInsert() && b.current.isRetain():
+			n := min(len(a.current.insert), b.current.retain)
+			composed.Insert(a.current.insert[:n])
+			consumeInsert(a, n)
+			consumeRetain(b, n)
+		default: // a: retain, b: delete
+			n := min(a.current.retain, b.current.delete)
+			composed.Delete(n)
+			consumeRetain(a, n)
+			consumeDelete(b, n)
+		}
+	}
+	return composed, nil
+}
+
+// TransformOperations は同じ文書に対する並行な操作 a, b を変換し、
+// a の後に適用する b' と、b の後に適用する a' を返す。同じ位置への挿入は a を先にする。
+func TransformOperations(a, b *TextOperation) (*TextOperation, *TextOperation, error) {
+	if a.baseLength != b.baseLength {
+		return nil, nil, fmt.Errorf("%w: transform %d / %d", ErrOperationLength, a.baseLength, b.baseLength)
+	}
+	aPrime, bPrime := NewTextOperation(), NewTextOperation()
+	x, y := newOperationCursor(a), newOperationCursor(b)
+	for x.ok || y.ok {
+		if x.ok && x.current.isInsert() {
+			aPrime.Insert(x.current.insert)
+			bPrime.Retain(len(x.current.insert))
+			x.advance()
+			continue
+		}
+		if y.ok && y.current.isInsert() {
+			aPrime.Retain(len(y.current.insert))
+			bPrime.Insert(y.current.insert)
+			y.advance()
+			continue
+		}
+		if !x.ok || !y.ok {
+			return nil, nil, fmt.Errorf("%w: transform", ErrOperationLength)
+		}
+		switch {
+		case x.current.isRetain() && y.current.isRetain():
+			n := min(x.current.retain, y.current.retain)
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+			consumeRetain(x, n)
+			consumeRetain(y, n)
+		case x.current.isDelete() && y.current.isDelete():
+			// 両方が消した部分は、どちらの変換後にも残らない
+			n := min(x.current.delete, y.current.delete)
+			consumeDelete(x, n)
+			consumeDelete(y, n)
+		case x.current.isDelete():
+			n := min(x.current.delete, y.current.retain)
+			aPrime.Delete(n)
+			consumeDelete(x, n)
+			consumeRetain(y, n)
+		default: // x: retain, y: delete
+			n := min(x.current.retain, y.current.delete)
+			bPrime.Delete(n)
+			consumeRetain(x, n)
+			consumeDelete(y, n)
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+func consumeRetain(c *operationCursor, n int) {
+	c.current.retain -= n
+	if c.current.retain == 0 {
+		c.advance()
+	}
+}
+
+func consumeInsert(c *operationCursor, n int) {
+	c.current.insert = c.current.insert[n:]
+	if c.current.insert == "" {
+		c.advance()
+	}
+}
+
+func consumeDelete(c *operationCursor, n int) {
+	c.current.delete -= n
+	if c.current.delete == 0 {
+		c.advance()
+	}
+}
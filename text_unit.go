@@ -0,0 +1,153 @@
+package main
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// TextUnit は TextEditor が位置や長さを数えるときの単位
+type TextUnit int
+
+const (
+	UnitByte TextUnit = iota
+	UnitRune
+	// UnitGrapheme は結合文字・異体字セレクタ・ZWJ 絵文字・国旗などを1文字として数える
+	UnitGrapheme
+)
+
+func (u TextUnit) String() string {
+	switch u {
+	case UnitByte:
+		return "byte"
+	case UnitRune:
+		return "rune"
+	case UnitGrapheme:
+		return "grapheme"
+	default:
+		return "unknown"
+	}
+}
+
+// next は s の先頭1単位のバイト長を返す
+func (u TextUnit) next(s string) int {
+	if s == "" {
+		return 0
+	}
+	switch u {
+	case UnitByte:
+		return 1
+	case UnitGrapheme:
+		return nextGrapheme(s)
+	default:
+		_, size := utf8.DecodeRuneInString(s)
+		return size
+	}
+}
+
+// count は s に含まれる単位の数を返す
+func (u TextUnit) count(s string) int {
+	switch u {
+	case UnitByte:
+		return len(s)
+	case UnitRune:
+		return utf8.RuneCountInString(s)
+	}
+	n := 0
+	for s != "" {
+		s = s[u.next(s):]
+		n++
+	}
+	return n
+}
+
+// byteOffset は先頭から pos 単位目のバイト位置を返す。範囲外なら false。
+func (u TextUnit) byteOffset(s string, pos int) (int, bool) {
+	if pos < 0 {
+		return 0, false
+	}
+	if u == UnitByte {
+		return pos, pos <= len(s)
+	}
+	offset := 0
+	for i := 0; i < pos; i++ {
+		if offset == len(s) {
+			return 0, false
+		}
+		offset += u.next(s[offset:])
+	}
+	return offset, true
+}
+
+// isBoundary は s のバイト位置 b が単位の区切りかどうかを返す
+func (u TextUnit) isBoundary(s string, b int) bool {
+	if u == UnitByte || b == 0 || b == len(s) {
+		return true
+	}
+	if u == UnitRune {
+		return utf8.RuneStart(s[b])
+	}
+	for offset := 0; offset < b; {
+		offset += u.next(s[offset:])
+		if offset == b {
+			return true
+		}
+	}
+	return false
+}
+
+// nextGrapheme は簡略化した書記素クラスタの区切り規則で、先頭クラスタのバイト長を返す
+func nextGrapheme(s string) int {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == '\r' && len(s) > size && s[size] == '\n' {
+		return size + 1
+	}
+	regional := isRegionalIndicator(r)
+extend:
+	for size < len(s) {
+		next, n := utf8.DecodeRuneInString(s[size:])
+		switch {
+		case regional && isRegionalIndicator(next):
+			// 国旗は地域指示記号2つで1文字
+			size += n
+			regional = false
+			continue
+		case next == '\u200d':
+			// ZWJ は直後の文字と結合する
+			size += n
+			if size < len(s) {
+				_, joined := utf8.DecodeRuneInString(s[size:])
+				size += joined
+			}
+			continue
+		case isGraphemeExtend(next):
+			size += n
+			continue
+		}
+		break extend
+	}
+	return size
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func isGraphemeExtend(r rune) bool {
+	switch {
+	case r < 0x300, r >= 0x3000 && r < 0x302A, r >= 0x3030 && r < 0x3099, r >= 0x309B && r < 0xA66F:
+		// ラテン文字の基本部分・かな・CJK 統合漢字などには結合文字がないので、表を引かずに済ませる
+		return false
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF:
+		// 異体字セレクタ
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF:
+		// 絵文字の肌の色
+		return true
+	case r >= 0xE0020 && r <= 0xE007F:
+		// タグ文字（地域の旗）
+		return true
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import "testing"
+
+var textUnitSamples = []struct {
+	name                  string
+	s                     string
+	bytes, runes, letters int
+}{
+	{"hiragana", "こんにちは", 15, 5, 5},
+	{"kanji and flag", "日本🇯🇵", 14, 4, 3},
+	{"combining acute", "e\u0301", 3, 2, 1},
+	{"variation selector", "❤️", 6, 2, 1},
+	{"skin tone", "👍🏽", 8, 2, 1},
+	{"zwj family", "👨‍👩‍👧", 18, 5, 1},
+	{"flag pair", "🇯🇵🇺🇸", 16, 4, 2},
+	{"tag flag", "🏴\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F", 28, 7, 1},
+	{"crlf", "a\r\nb", 4, 4, 3},
+}
+
+func TestTextUnitCount(t *testing.T) {
+	for _, tt := range textUnitSamples {
+		for unit, want := range map[TextUnit]int{UnitByte: tt.bytes, UnitRune: tt.runes, UnitGrapheme: tt.letters} {
+			if got := unit.count(tt.s); got != want {
+				t.Errorf("%s: %s count = %d, want %d", tt.name, unit, got, want)
+			}
+			// 各単位の区切りで切り出した断片をつなぐと元に戻り、断片の境目はすべて区切りになる
+			joined := ""
+			for i := 0; i < want; i++ {
+				from, _ := unit.byteOffset(tt.s, i)
+				to, ok := unit.byteOffset(tt.s, i+1)
+				if !ok || !unit.isBoundary(tt.s, to) {
+					t.Fatalf("%s: %s offset %d = %d, %v", tt.name, unit, i+1, to, ok)
+				}
+				joined += tt.s[from:to]
+			}
+			if joined != tt.s {
+				t.Errorf("%s: %s pieces join to %q", tt.name, unit, joined)
+			}
+			if _, ok := unit.byteOffset(tt.s, want+1); ok {
+				t.Errorf("%s: %s offset %d is in range", tt.name, unit, want+1)
+			}
+		}
+	}
+}
+
+func TestEditorCommandsOnMultibyteText(t *testing.T) {
+	editor := NewTextEditor(WithTextUnit(UnitGrapheme))
+	invoker := NewCommandInvoker()
+	steps := []struct {
+		name    string
+		command Command
+		want    string
+	}{
+		{"write", NewWriteCommand(editor, "こんにちは👍🏽"), "こんにちは👍🏽"},
+		{"delete emoji with skin tone", NewDeleteCommand(editor, 1), "こんにちは"},
+		{"insert flag", NewInsertCommand(editor, 2, "🇯🇵"), "こん🇯🇵にちは"},
+		{"insert combining", NewInsertCommand(editor, 0, "e\u0301"), "e\u0301こん🇯🇵にちは"},
+		{"delete range", NewDeleteRangeCommand(editor, 1, 4), "e\u0301にちは"},
+		{"select family", NewSelectCommand(editor, 1, 3), "e\u0301にちは"},
+		{"replace selection", NewReplaceSelectionCommand(editor, "👨‍👩‍👧"), "e\u0301👨‍👩‍👧は"},
+		{"replace inside grapheme", NewPatternReplaceCommand(editor, "e", "a"), "e\u0301👨‍👩‍👧は"},
+		{"delete two", NewDeleteCommand(editor, 2), "e\u0301"},
+	}
+	var contents []string
+	for _, step := range steps {
+		contents = append(contents, editor.GetContent())
+		if err := invoker.ExecuteCommand(step.command); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := editor.GetContent(); got != step.want {
+			t.Fatalf("%s: content = %q, want %q", step.name, got, step.want)
+		}
+	}
+	if got := editor.Length(); got != 1 {
+		t.Errorf("Length() = %d, want 1", got)
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		if err := invoker.UndoLastCommand(); err != nil {
+			t.Fatalf("undo %s: %v", steps[i].name, err)
+		}
+		if got := editor.GetContent(); got != contents[i] {
+			t.Errorf("undo %s: content = %q, want %q", steps[i].name, got, contents[i])
+		}
+	}
+}
+
+// 位置の単位が違えば、同じ操作でも消える範囲や置き換わる箇所が変わる
+func TestEditorUnitChangesPositions(t *testing.T) {
+	tests := []struct {
+		unit        TextUnit
+		deleted     string
+		replaced    string
+		cursorAfter int
+	}{
+		{UnitByte, "e\u0301e\xcc", "a\u0301a\u0301", 6},
+		{UnitRune, "e\u0301e", "a\u0301a\u0301", 4},
+		{UnitGrapheme, "e\u0301", "e\u0301e\u0301", 2},
+	}
+	for _, tt := range tests {
+		editor := NewTextEditor(WithTextUnit(tt.unit))
+		editor.SetContent("e\u0301e\u0301")
+		if err := editor.MoveCursor(editor.Length()); err != nil {
+			t.Fatalf("%s: MoveCursor: %v", tt.unit, err)
+		}
+		if got := editor.GetCursor(); got != tt.cursorAfter {
+			t.Errorf("%s: cursor = %d, want %d", tt.unit, got, tt.cursorAfter)
+		}
+
+		NewPatternReplaceCommand(editor, "e", "a").Execute()
+		if got := editor.GetContent(); got != tt.replaced {
+			t.Errorf("%s: after replace %q, want %q", tt.unit, got, tt.replaced)
+		}
+
+		editor.SetContent("e\u0301e\u0301")
+		editor.DeleteText(1)
+		if got := editor.GetContent(); got != tt.deleted {
+			t.Errorf("%s: after delete %q, want %q", tt.unit, got, tt.deleted)
+		}
+	}
+}